@@ -0,0 +1,594 @@
+package gulter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayinke-llc/hermes"
+)
+
+const (
+	ErrChecksumMismatch = errorMsg("gulter: chunk does not match its checksum")
+	ErrUploadExpired    = errorMsg("gulter: upload has expired")
+	ErrUploadIncomplete = errorMsg("gulter: upload is missing chunks")
+)
+
+const (
+	defaultChunkSize         int64 = 1024 * 1024 * 8
+	defaultChunkedExpiration       = 24 * time.Hour
+
+	// maxChunks keeps the amount of chunks within what S3 allows for a
+	// single multipart upload
+	maxChunks = 10000
+
+	// ChunkChecksumHeader is the header that holds the hex encoded SHA-256
+	// checksum of a chunk
+	ChunkChecksumHeader = "X-Chunk-Checksum"
+)
+
+// ChunkedUploadOptions configures the chunked upload handler
+type ChunkedUploadOptions struct {
+	// BasePath is the path the handler is mounted at, like /uploads/
+	BasePath string
+
+	// Store keeps the sessions and, unless the storage of Field is a
+	// MultipartStorage, the chunks until the upload is complete
+	Store ChunkStore
+
+	// Field holds the rules completed files are validated with and the
+	// storage they are moved to. Its MaxFileSize is also the largest upload
+	// that can be started
+	Field FieldSpec
+
+	// ChunkSize is the size of every chunk but the last one. Chunks are
+	// held in memory while their checksum is verified. It is raised to the
+	// minimum part size of MultipartStorage backends and for files that
+	// would otherwise need more than 10,000 chunks. Defaults to 8MB
+	ChunkSize int64
+
+	// Expiration is how long clients have to complete an upload.
+	// Defaults to 24 hours
+	Expiration time.Duration
+
+	// OnComplete is called once a file has been validated and uploaded to
+	// the storage backend
+	OnComplete func(r *http.Request, file File)
+}
+
+// ChunkedUploadHandler implements a simple chunked upload API for clients
+// that do not speak tus:
+//
+//	POST   {BasePath}                     starts an upload
+//	GET    {BasePath}{id}                 returns the chunks received so far
+//	PUT    {BasePath}{id}/chunks/{index}  uploads a chunk
+//	POST   {BasePath}{id}/complete        assembles and validates the file
+//	DELETE {BasePath}{id}                 aborts the upload
+//
+// Chunks can be uploaded in any order and concurrently. Every chunk must be
+// sent with its SHA-256 checksum in the X-Chunk-Checksum header
+type ChunkedUploadHandler struct {
+	gulter    *Gulter
+	opts      ChunkedUploadOptions
+	field     FieldSpec
+	multipart MultipartStorage
+	mux       *http.ServeMux
+
+	// makes sure a session is not updated by multiple requests at once
+	locks uploadLocks
+}
+
+// ChunkedUploadRequest is the body of the request that starts an upload
+type ChunkedUploadRequest struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+// ChunkedUploadStatus is returned when an upload is started and whenever a
+// chunk is received
+type ChunkedUploadStatus struct {
+	ID          string    `json:"id"`
+	ChunkSize   int64     `json:"chunk_size"`
+	TotalChunks int       `json:"total_chunks"`
+	Received    []int     `json:"received"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ChunkedUploads returns a handler for the chunked upload API. If the storage
+// of the field is a MultipartStorage, like S3, every chunk is sent to the
+// backend as a part of a multipart upload so the file is never reassembled
+// locally. Otherwise chunks are kept in the ChunkStore and the file is
+// uploaded to the storage once it is complete.
+// Either way, the completed file goes through the same mimetype detection
+// and validation as the middleware
+func (h *Gulter) ChunkedUploads(opts ChunkedUploadOptions) (*ChunkedUploadHandler, error) {
+	if opts.Store == nil {
+		return nil, errors.New("gulter: please provide a chunk store")
+	}
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+
+	if opts.Expiration <= 0 {
+		opts.Expiration = defaultChunkedExpiration
+	}
+
+	if !strings.HasSuffix(opts.BasePath, "/") {
+		opts.BasePath += "/"
+	}
+
+	c := &ChunkedUploadHandler{
+		gulter: h,
+		opts:   opts,
+		field:  h.fieldSpec(opts.Field),
+	}
+
+	if multipartStorage, ok := c.field.Storage.(MultipartStorage); ok {
+		c.multipart = multipartStorage
+		c.opts.ChunkSize = max(c.opts.ChunkSize, multipartStorage.MinPartSize())
+	}
+
+	c.mux = http.NewServeMux()
+	c.mux.HandleFunc("POST "+opts.BasePath+"{$}", c.create)
+	c.mux.HandleFunc("GET "+opts.BasePath+"{id}", c.status)
+	c.mux.HandleFunc("DELETE "+opts.BasePath+"{id}", c.abort)
+	c.mux.HandleFunc("PUT "+opts.BasePath+"{id}/chunks/{index}", c.uploadChunk)
+	c.mux.HandleFunc("POST "+opts.BasePath+"{id}/complete", c.complete)
+
+	return c, nil
+}
+
+func (c *ChunkedUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mux.ServeHTTP(w, r)
+}
+
+// Cleanup removes the sessions that have expired along with their chunks.
+// Multipart uploads of expired sessions are aborted. Call it periodically to
+// get rid of uploads that were abandoned by the client
+func (c *ChunkedUploadHandler) Cleanup(ctx context.Context) error {
+	sessions, err := c.opts.Store.ExpiredSessions(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, session := range sessions {
+		if err := c.remove(ctx, session); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// remove deletes a session and aborts its multipart upload
+func (c *ChunkedUploadHandler) remove(ctx context.Context, session *ChunkedSession) error {
+	ctx = context.WithoutCancel(ctx)
+
+	if session.Multipart != nil && c.multipart != nil {
+		if err := c.multipart.AbortMultipartUpload(ctx, session.Multipart); err != nil {
+			return fmt.Errorf("gulter: could not abort multipart upload (%s)...%w", session.ID, err)
+		}
+	}
+
+	if err := c.opts.Store.DeleteSession(ctx, session.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// session retrieves a session that has not expired yet
+func (c *ChunkedUploadHandler) session(ctx context.Context, id string) (*ChunkedSession, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("gulter: invalid upload id (%s)...%w", id, ErrFileNotFound)
+	}
+
+	session, err := c.opts.Store.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		if err := c.remove(ctx, session); err != nil {
+			return nil, err
+		}
+
+		return nil, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     -1,
+			Err:       ErrUploadExpired,
+		}
+	}
+
+	return session, nil
+}
+
+func (c *ChunkedUploadHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req ChunkedUploadRequest
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024*64)).Decode(&req); err != nil {
+		c.error(w, r, &ChunkedUploadError{Chunk: -1, Err: err})
+		return
+	}
+
+	if hermes.IsStringEmpty(req.FileName) {
+		c.error(w, r, &ChunkedUploadError{Chunk: -1, Err: errors.New("please provide a file name")})
+		return
+	}
+
+	if req.Size <= 0 {
+		c.error(w, r, &ChunkedUploadError{Chunk: -1, Err: errors.New("please provide the size of the file")})
+		return
+	}
+
+	if c.field.MaxFileSize > 0 && req.Size > c.field.MaxFileSize {
+		c.error(w, r, &SizeLimitError{
+			FieldName: c.field.Name,
+			FileName:  req.FileName,
+			Limit:     c.field.MaxFileSize,
+		})
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	chunkSize := c.opts.ChunkSize
+	if req.Size/chunkSize >= maxChunks {
+		chunkSize = req.Size/maxChunks + 1
+	}
+
+	session := &ChunkedSession{
+		ID:          hex.EncodeToString(b),
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((req.Size + chunkSize - 1) / chunkSize),
+		Chunks:      make(map[int]string),
+		ExpiresAt:   time.Now().Add(c.opts.Expiration).UTC(),
+	}
+
+	if c.multipart != nil {
+		upload, err := c.multipart.CreateMultipartUpload(r.Context(), &UploadFileOptions{
+			FileName:    c.field.NameGenerator(req.FileName),
+			ContentType: req.ContentType,
+			Metadata: map[string]string{
+				MetadataOriginalName: url.PathEscape(req.FileName),
+			},
+		})
+		if err != nil {
+			c.error(w, r, &StorageError{
+				FieldName: c.field.Name,
+				FileName:  req.FileName,
+				Err:       err,
+			})
+			return
+		}
+
+		session.Multipart = upload
+	}
+
+	if err := c.opts.Store.SaveSession(r.Context(), session); err != nil {
+		c.error(w, r, errors.Join(err, c.remove(r.Context(), session)))
+		return
+	}
+
+	writeJSON(w, "application/json", http.StatusCreated, sessionStatus(session))
+}
+
+func (c *ChunkedUploadHandler) status(w http.ResponseWriter, r *http.Request) {
+	session, err := c.session(r.Context(), r.PathValue("id"))
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	writeJSON(w, "application/json", http.StatusOK, sessionStatus(session))
+}
+
+func (c *ChunkedUploadHandler) abort(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// unknown ids are rejected before a lock is taken for them
+	if _, err := c.session(r.Context(), id); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	unlock := c.locks.lock(id)
+	defer unlock()
+
+	// the session is retrieved again in case another request completed or
+	// aborted it in the meantime
+	session, err := c.session(r.Context(), id)
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	if err := c.remove(r.Context(), session); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *ChunkedUploadHandler) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	session, err := c.session(ctx, id)
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= session.TotalChunks {
+		c.error(w, r, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     index,
+			Err:       fmt.Errorf("chunk index must be between 0 and %d", session.TotalChunks-1),
+		})
+		return
+	}
+
+	checksum, err := hex.DecodeString(r.Header.Get(ChunkChecksumHeader))
+	if err != nil || len(checksum) != sha256.Size {
+		c.error(w, r, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     index,
+			Err:       fmt.Errorf("please provide the SHA-256 checksum of the chunk in the %s header", ChunkChecksumHeader),
+		})
+		return
+	}
+
+	size := session.chunkSize(index)
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, size+1))
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	if int64(len(data)) != size {
+		c.error(w, r, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     index,
+			Err:       fmt.Errorf("chunk must be %d bytes", size),
+		})
+		return
+	}
+
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], checksum) {
+		c.error(w, r, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     index,
+			Err:       ErrChecksumMismatch,
+		})
+		return
+	}
+
+	var etag string
+
+	if session.Multipart != nil {
+		etag, err = c.multipart.UploadPart(ctx, session.Multipart, index+1, bytes.NewReader(data), size)
+	} else {
+		err = c.opts.Store.WriteChunk(ctx, id, index, bytes.NewReader(data))
+	}
+
+	if err != nil {
+		c.error(w, r, &StorageError{
+			FieldName: c.field.Name,
+			FileName:  session.FileName,
+			Err:       err,
+		})
+		return
+	}
+
+	// chunks are uploaded concurrently, so the session is retrieved again
+	// to make sure chunks recorded in the meantime are not lost
+	unlock := c.locks.lock(id)
+	defer unlock()
+
+	session, err = c.session(ctx, id)
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	if session.Chunks == nil {
+		session.Chunks = make(map[int]string)
+	}
+
+	session.Chunks[index] = etag
+
+	if err := c.opts.Store.SaveSession(ctx, session); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	writeJSON(w, "application/json", http.StatusOK, sessionStatus(session))
+}
+
+func (c *ChunkedUploadHandler) complete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	// unknown ids are rejected before a lock is taken for them
+	if _, err := c.session(ctx, id); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	unlock := c.locks.lock(id)
+	defer unlock()
+
+	// the session is retrieved again in case another request completed or
+	// aborted it in the meantime
+	session, err := c.session(ctx, id)
+	if err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	if missing := session.missingChunks(); len(missing) > 0 {
+		c.error(w, r, &ChunkedUploadError{
+			SessionID: id,
+			Chunk:     -1,
+			Err:       fmt.Errorf("%w: missing chunks %v", ErrUploadIncomplete, missing),
+		})
+		return
+	}
+
+	var file File
+
+	if session.Multipart != nil {
+		file, err = c.completeMultipart(r, session)
+	} else {
+		file, err = c.completeChunks(r, session)
+	}
+
+	if err != nil {
+		// the session is kept if the storage failed so the client can try
+		// again, but rejected files will never be accepted
+		var validationErr *ValidationError
+		var sizeErr *SizeLimitError
+
+		if errors.As(err, &validationErr) || errors.As(err, &sizeErr) {
+			err = errors.Join(err, c.opts.Store.DeleteSession(context.WithoutCancel(ctx), id))
+		}
+
+		c.error(w, r, err)
+		return
+	}
+
+	if err := c.opts.Store.DeleteSession(context.WithoutCancel(ctx), id); err != nil {
+		c.error(w, r, err)
+		return
+	}
+
+	if c.opts.OnComplete != nil {
+		c.opts.OnComplete(r, file)
+	}
+
+	writeJSON(w, "application/json", http.StatusOK, file)
+}
+
+// completeMultipart assembles the parts in the storage backend and validates
+// the resulting file. Rejected files are deleted from the storage
+func (c *ChunkedUploadHandler) completeMultipart(r *http.Request, session *ChunkedSession) (File, error) {
+	parts := make([]MultipartPart, 0, len(session.Chunks))
+
+	for index, etag := range session.Chunks {
+		parts = append(parts, MultipartPart{Number: index + 1, ETag: etag})
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+
+	metadata, err := c.multipart.CompleteMultipartUpload(r.Context(), session.Multipart, parts)
+	if err != nil {
+		return File{}, &StorageError{
+			FieldName: c.field.Name,
+			FileName:  session.FileName,
+			Err:       err,
+		}
+	}
+
+	// the parts are gone once the upload is complete, so the session
+	// cannot be completed again even if the file is rejected
+	if err := c.opts.Store.DeleteSession(context.WithoutCancel(r.Context()), session.ID); err != nil {
+		return File{}, err
+	}
+
+	file, err := c.gulter.ConfirmUpload(r, c.field, UploadKey{Key: metadata.Key}, metadata.Key, session.FileName)
+	if err != nil {
+		return File{}, err
+	}
+
+	file.FolderDestination = metadata.FolderDestination
+
+	return file, nil
+}
+
+// completeChunks streams the chunks from the store to the storage backend.
+// Validators can read the first 64KB of the file
+func (c *ChunkedUploadHandler) completeChunks(r *http.Request, session *ChunkedSession) (File, error) {
+	rc, err := c.opts.Store.OpenChunks(r.Context(), session.ID, session.TotalChunks)
+	if err != nil {
+		return File{}, err
+	}
+
+	defer rc.Close()
+
+	peeked, err := io.ReadAll(io.LimitReader(rc, peekLen))
+	if err != nil {
+		return File{}, err
+	}
+
+	content := bytes.NewReader(peeked)
+
+	mimeType, err := c.gulter.detectMimeType(content)
+	if err != nil {
+		return File{}, fmt.Errorf("gulter: %s has invalid mimetype..%v", c.field.Name, err)
+	}
+
+	header := &multipart.FileHeader{
+		Filename: session.FileName,
+		Header:   textproto.MIMEHeader{},
+		Size:     session.Size,
+	}
+
+	if session.ContentType != "" {
+		header.Header.Set("Content-Type", session.ContentType)
+	}
+
+	return c.gulter.uploadFile(r, c.field, header, mimeType, content,
+		io.MultiReader(bytes.NewReader(peeked), rc))
+}
+
+func (c *ChunkedUploadHandler) error(w http.ResponseWriter, r *http.Request, err error) {
+	c.gulter.errorResponseHandler(err).ServeHTTP(w, r)
+}
+
+func sessionStatus(session *ChunkedSession) ChunkedUploadStatus {
+	received := make([]int, 0, len(session.Chunks))
+	for index := range session.Chunks {
+		received = append(received, index)
+	}
+
+	sort.Ints(received)
+
+	return ChunkedUploadStatus{
+		ID:          session.ID,
+		ChunkSize:   session.ChunkSize,
+		TotalChunks: session.TotalChunks,
+		Received:    received,
+		ExpiresAt:   session.ExpiresAt,
+	}
+}
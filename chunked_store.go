@@ -0,0 +1,291 @@
+package gulter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChunkedSession describes an upload made with the chunked upload API
+type ChunkedSession struct {
+	ID string `json:"id"`
+
+	// FileName is the original name of the file
+	FileName string `json:"file_name"`
+
+	// ContentType declared by the client
+	ContentType string `json:"content_type,omitempty"`
+
+	// Size of the entire file in bytes
+	Size int64 `json:"size"`
+
+	// ChunkSize is the size of every chunk but the last one
+	ChunkSize int64 `json:"chunk_size"`
+
+	TotalChunks int `json:"total_chunks"`
+
+	// Chunks that have been received so far, by index. The value is the
+	// ETag of the part if the storage is a MultipartStorage
+	Chunks map[int]string `json:"chunks,omitempty"`
+
+	// Multipart is the upload the chunks are sent to if the storage is a
+	// MultipartStorage
+	Multipart *MultipartUpload `json:"multipart,omitempty"`
+
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// missingChunks returns the indexes of the chunks that have not been received
+func (s *ChunkedSession) missingChunks() []int {
+	var missing []int
+
+	for i := range s.TotalChunks {
+		if _, ok := s.Chunks[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+
+	return missing
+}
+
+// chunkSize returns the size the chunk at index must have
+func (s *ChunkedSession) chunkSize(index int) int64 {
+	if index == s.TotalChunks-1 {
+		return s.Size - int64(index)*s.ChunkSize
+	}
+
+	return s.ChunkSize
+}
+
+// ChunkStore keeps the sessions of chunked uploads and, unless the storage is
+// a MultipartStorage, the chunks themselves until the upload is complete
+type ChunkStore interface {
+	// SaveSession creates or updates a session
+	SaveSession(ctx context.Context, session *ChunkedSession) error
+
+	// GetSession retrieves a session. ErrFileNotFound is returned if it
+	// does not exist
+	GetSession(ctx context.Context, id string) (*ChunkedSession, error)
+
+	// WriteChunk stores the chunk at index, replacing it if it was already
+	// written
+	WriteChunk(ctx context.Context, id string, index int, r io.Reader) error
+
+	// OpenChunks returns the first count chunks of a session concatenated
+	// in order
+	OpenChunks(ctx context.Context, id string, count int) (io.ReadCloser, error)
+
+	// DeleteSession removes the session and its chunks. Deleting a session
+	// that does not exist is not an error
+	DeleteSession(ctx context.Context, id string) error
+
+	// ExpiredSessions lists the sessions that expired before the given time
+	ExpiredSessions(ctx context.Context, before time.Time) ([]*ChunkedSession, error)
+}
+
+type diskChunkStore struct {
+	root *os.Root
+}
+
+// NewDiskChunkStore returns a ChunkStore that keeps sessions in a local
+// folder. Every session is made up of a .json file with its details and a
+// folder with a file for every chunk
+func NewDiskChunkStore(pathToFolder string) (ChunkStore, error) {
+	root, err := os.OpenRoot(pathToFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskChunkStore{root: root}, nil
+}
+
+func (d *diskChunkStore) SaveSession(_ context.Context, session *ChunkedSession) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	tmp := session.ID + ".json.tmp"
+
+	if err := d.root.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return d.root.Rename(tmp, session.ID+".json")
+}
+
+func (d *diskChunkStore) GetSession(_ context.Context, id string) (*ChunkedSession, error) {
+	b, err := d.root.ReadFile(id + ".json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%v...%w", err, ErrFileNotFound)
+		}
+
+		return nil, err
+	}
+
+	var session ChunkedSession
+	if err := json.Unmarshal(b, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (d *diskChunkStore) WriteChunk(_ context.Context, id string, index int, r io.Reader) error {
+	if err := d.root.MkdirAll(id, 0o700); err != nil {
+		return err
+	}
+
+	name := chunkPath(id, index)
+	tmp := name + ".tmp"
+
+	f, err := d.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return d.root.Rename(tmp, name)
+}
+
+// OpenChunks only makes sure all the chunks exist. They are opened one after
+// the other as they are read so a session with thousands of chunks does not
+// hold thousands of files open
+func (d *diskChunkStore) OpenChunks(_ context.Context, id string, count int) (io.ReadCloser, error) {
+	for i := range count {
+		if _, err := d.root.Stat(chunkPath(id, i)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%v...%w", err, ErrFileNotFound)
+			}
+
+			return nil, err
+		}
+	}
+
+	return &chunkReader{root: d.root, id: id, count: count}, nil
+}
+
+func chunkPath(id string, index int) string {
+	return path.Join(id, strconv.Itoa(index))
+}
+
+func (d *diskChunkStore) DeleteSession(_ context.Context, id string) error {
+	if err := d.root.RemoveAll(id); err != nil {
+		return err
+	}
+
+	if err := d.root.Remove(id + ".json"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *diskChunkStore) ExpiredSessions(ctx context.Context, before time.Time) ([]*ChunkedSession, error) {
+	entries, err := fs.ReadDir(d.root.FS(), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*ChunkedSession
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		session, err := d.GetSession(ctx, id)
+		if err != nil {
+			// the session might have been completed in the meantime
+			if errors.Is(err, ErrFileNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if session.ExpiresAt.Before(before) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+// chunkReader reads the chunks of a session one after the other
+type chunkReader struct {
+	root  *os.Root
+	id    string
+	count int
+
+	// the chunk being read, next is the index of the chunk after it
+	current *os.File
+	next    int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if c.next >= c.count {
+				return 0, io.EOF
+			}
+
+			f, err := c.root.Open(chunkPath(c.id, c.next))
+			if err != nil {
+				return 0, err
+			}
+
+			c.current = f
+			c.next++
+		}
+
+		n, err := c.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			if err := c.Close(); err != nil {
+				return n, err
+			}
+
+			if n == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+
+	err := c.current.Close()
+	c.current = nil
+
+	return err
+}
@@ -0,0 +1,394 @@
+package gulter_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/adelowo/gulter/mocks"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newChunkedHandler(t *testing.T, storage gulter.Storage,
+	opts gulter.ChunkedUploadOptions,
+) (*gulter.ChunkedUploadHandler, gulter.ChunkStore) {
+	t.Helper()
+
+	store, err := gulter.NewDiskChunkStore(t.TempDir())
+	require.NoError(t, err)
+
+	g, err := gulter.New(gulter.WithStorage(storage))
+	require.NoError(t, err)
+
+	opts.BasePath = "/uploads/"
+	opts.Store = store
+
+	handler, err := g.ChunkedUploads(opts)
+	require.NoError(t, err)
+
+	return handler, store
+}
+
+func startChunkedUpload(t *testing.T, handler http.Handler, fileName string, size int) gulter.ChunkedUploadStatus {
+	t.Helper()
+
+	body, err := json.Marshal(gulter.ChunkedUploadRequest{
+		FileName:    fileName,
+		ContentType: "image/jpeg",
+		Size:        int64(size),
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads/", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var status gulter.ChunkedUploadStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+
+	return status
+}
+
+func uploadChunk(handler http.Handler, id string, index int, chunk []byte, checksum []byte) *httptest.ResponseRecorder {
+	if checksum == nil {
+		sum := sha256.Sum256(chunk)
+		checksum = sum[:]
+	}
+
+	r := httptest.NewRequest(http.MethodPut,
+		"/uploads/"+id+"/chunks/"+strconv.Itoa(index), bytes.NewReader(chunk))
+	r.Header.Set(gulter.ChunkChecksumHeader, hex.EncodeToString(checksum))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func completeChunkedUpload(handler http.Handler, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads/"+id+"/complete", nil))
+
+	return w
+}
+
+func TestChunkedUploads(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	var uploaded []byte
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, r io.Reader, opts *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+			require.Equal(t, "image/jpeg", opts.ContentType)
+
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			uploaded = b
+
+			return &gulter.UploadedFileMetadata{
+				Key:  opts.FileName,
+				Size: int64(len(b)),
+			}, nil
+		}).
+		Times(1)
+
+	var completed []gulter.File
+
+	chunkSize := len(image)/3 + 1
+
+	handler, store := newChunkedHandler(t, storage, gulter.ChunkedUploadOptions{
+		Field: gulter.FieldSpec{
+			Name:      "avatar",
+			Validator: gulter.MimeTypeValidator("image/jpeg"),
+		},
+		ChunkSize: int64(chunkSize),
+		OnComplete: func(_ *http.Request, file gulter.File) {
+			completed = append(completed, file)
+		},
+	})
+
+	status := startChunkedUpload(t, handler, "avatar.jpg", len(image))
+	require.Equal(t, 3, status.TotalChunks)
+	require.Equal(t, int64(chunkSize), status.ChunkSize)
+	require.Empty(t, status.Received)
+
+	chunks := [][]byte{
+		image[:chunkSize],
+		image[chunkSize : chunkSize*2],
+		image[chunkSize*2:],
+	}
+
+	w := uploadChunk(handler, status.ID, 1, chunks[1], make([]byte, sha256.Size))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), gulter.ErrorCodeChecksumMismatch)
+
+	w = uploadChunk(handler, status.ID, 1, chunks[1][1:], nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = uploadChunk(handler, status.ID, 3, chunks[1], nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// chunks can arrive in any order
+	for _, index := range []int{2, 0} {
+		w = uploadChunk(handler, status.ID, index, chunks[index], nil)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uploads/"+status.ID, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, []int{0, 2}, status.Received)
+
+	w = completeChunkedUpload(handler, status.ID)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), gulter.ErrorCodeUploadIncomplete)
+
+	w = uploadChunk(handler, status.ID, 1, chunks[1], nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = completeChunkedUpload(handler, status.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var file gulter.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+
+	require.Equal(t, image, uploaded)
+	require.Equal(t, "avatar", file.FieldName)
+	require.Equal(t, "avatar.jpg", file.OriginalName)
+	require.Equal(t, "image/jpeg", file.MimeType)
+	require.Equal(t, int64(len(image)), file.Size)
+	require.Equal(t, []gulter.File{file}, completed)
+
+	_, err = store.GetSession(context.Background(), status.ID)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestChunkedUploads_ValidationFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+
+	handler, store := newChunkedHandler(t, storage, gulter.ChunkedUploadOptions{
+		Field: gulter.FieldSpec{
+			Name:      "avatar",
+			Validator: gulter.MimeTypeValidator("image/jpeg"),
+		},
+	})
+
+	content := []byte("<html><script>alert(1)</script></html>")
+
+	status := startChunkedUpload(t, handler, "avatar.jpg", len(content))
+	require.Equal(t, 1, status.TotalChunks)
+
+	w := uploadChunk(handler, status.ID, 0, content, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = completeChunkedUpload(handler, status.ID)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	_, err := store.GetSession(context.Background(), status.ID)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestChunkedUploads_Sessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, store := newChunkedHandler(t, mocks.NewMockStorage(ctrl), gulter.ChunkedUploadOptions{
+		Field: gulter.FieldSpec{
+			Name:        "avatar",
+			MaxFileSize: 1024,
+		},
+		ChunkSize: 4,
+	})
+
+	t.Run("upload is too large", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads/",
+			bytes.NewReader([]byte(`{"file_name":"avatar.jpg","size":2048}`))))
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads/",
+			bytes.NewReader([]byte(`{"size":20}`))))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("abort upload", func(t *testing.T) {
+		status := startChunkedUpload(t, handler, "avatar.jpg", 10)
+
+		w := uploadChunk(handler, status.ID, 0, []byte("gult"), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/uploads/"+status.ID, nil))
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uploads/"+status.ID, nil))
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("unknown uploads", func(t *testing.T) {
+		for _, id := range []string{"not-an-id", "0123456789abcdef0123456789abcdef"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/uploads/"+id, nil))
+			require.Equal(t, http.StatusNotFound, w.Code)
+
+			w = completeChunkedUpload(handler, id)
+			require.Equal(t, http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("expired uploads", func(t *testing.T) {
+		status := startChunkedUpload(t, handler, "avatar.jpg", 10)
+
+		session, err := store.GetSession(context.Background(), status.ID)
+		require.NoError(t, err)
+
+		session.ExpiresAt = time.Now().Add(-time.Minute)
+		require.NoError(t, store.SaveSession(context.Background(), session))
+
+		w := uploadChunk(handler, status.ID, 0, []byte("gult"), nil)
+		require.Equal(t, http.StatusGone, w.Code)
+
+		_, err = store.GetSession(context.Background(), status.ID)
+		require.ErrorIs(t, err, gulter.ErrFileNotFound)
+	})
+
+	t.Run("abandoned uploads are cleaned up", func(t *testing.T) {
+		expired := startChunkedUpload(t, handler, "avatar.jpg", 10)
+		active := startChunkedUpload(t, handler, "avatar.jpg", 10)
+
+		w := uploadChunk(handler, expired.ID, 0, []byte("gult"), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		session, err := store.GetSession(context.Background(), expired.ID)
+		require.NoError(t, err)
+
+		session.ExpiresAt = time.Now().Add(-time.Minute)
+		require.NoError(t, store.SaveSession(context.Background(), session))
+
+		require.NoError(t, handler.Cleanup(context.Background()))
+
+		_, err = store.GetSession(context.Background(), expired.ID)
+		require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+		_, err = store.GetSession(context.Background(), active.ID)
+		require.NoError(t, err)
+	})
+}
+
+func TestChunkedUploads_ConcurrentCompletes(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, r io.Reader, opts *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+			n, err := io.Copy(io.Discard, r)
+			require.NoError(t, err)
+
+			return &gulter.UploadedFileMetadata{Key: opts.FileName, Size: n}, nil
+		}).
+		Times(1)
+
+	handler, _ := newChunkedHandler(t, storage, gulter.ChunkedUploadOptions{
+		Field: gulter.FieldSpec{Name: "avatar"},
+	})
+
+	status := startChunkedUpload(t, handler, "avatar.jpg", len(image))
+
+	w := uploadChunk(handler, status.ID, 0, image, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	codes := make(chan int, 10)
+
+	var wg sync.WaitGroup
+
+	for range cap(codes) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			codes <- completeChunkedUpload(handler, status.ID).Code
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	var completed int
+
+	for code := range codes {
+		if code == http.StatusOK {
+			completed++
+			continue
+		}
+
+		require.Equal(t, http.StatusNotFound, code)
+	}
+
+	require.Equal(t, 1, completed)
+}
+
+func TestDiskChunkStore_OpenChunks(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := gulter.NewDiskChunkStore(t.TempDir())
+	require.NoError(t, err)
+
+	var expected bytes.Buffer
+
+	for i := range 100 {
+		chunk := []byte(strconv.Itoa(i) + ",")
+		expected.Write(chunk)
+
+		require.NoError(t, store.WriteChunk(ctx, "gulter", i, bytes.NewReader(chunk)))
+	}
+
+	rc, err := store.OpenChunks(ctx, "gulter", 100)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, expected.String(), string(b))
+
+	_, err = store.OpenChunks(ctx, "gulter", 101)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
@@ -13,18 +13,43 @@ var (
 	}
 
 	// defaultNameGeneratorFunc uses the gulter-158888-originalname to
-	// upload files
+	// upload files. The original name is sanitized since it is provided
+	// by the client
 	defaultNameGeneratorFunc NameGeneratorFunc = func(s string) string {
-		return fmt.Sprintf("gulter-%d-%s", time.Now().Unix(), s)
+		return fmt.Sprintf("gulter-%d-%s", time.Now().Unix(), SanitizeFilename(s))
 	}
 
 	defaultFileUploadMaxSize int64 = 1024 * 1024 * 5
 
 	defaultErrorResponseHandler ErrResponseHandler = func(err error) http.HandlerFunc {
 		return func(w http.ResponseWriter, _ *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"message" : "could not upload file", "error" : %s}`, err.Error())
+			fieldName, fileName := errorDetails(err)
+
+			writeJSON(w, "application/json", ErrorStatusCode(err), ErrorResponse{
+				Message:   "could not upload file",
+				Error:     err.Error(),
+				Code:      ErrorCode(err),
+				FieldName: fieldName,
+				FileName:  fileName,
+			})
+		}
+	}
+
+	// problemDetailsResponseHandler writes errors as RFC 7807 problem details
+	problemDetailsResponseHandler ErrResponseHandler = func(err error) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			fieldName, fileName := errorDetails(err)
+			status := ErrorStatusCode(err)
+
+			writeJSON(w, "application/problem+json", status, ProblemDetails{
+				Type:      "about:blank",
+				Title:     http.StatusText(status),
+				Status:    status,
+				Detail:    err.Error(),
+				Code:      ErrorCode(err),
+				FieldName: fieldName,
+				FileName:  fileName,
+			})
 		}
 	}
 )
@@ -37,16 +62,68 @@ func WithStorage(store Storage) Option {
 	}
 }
 
-// WithMaxFileSize allows you limit the size of file uploads to accept
+// WithMaxFileSize allows you limit the size of each uploaded file.
+// If WithMaxRequestSize is not provided, this is also used as the limit for
+// the entire request
 func WithMaxFileSize(i int64) Option {
 	return func(gh *Gulter) {
-		gh.maxSize = i
+		gh.maxFileSize = i
+	}
+}
+
+// WithMaxRequestSize limits the size of the entire request body including
+// all files and form values
+func WithMaxRequestSize(i int64) Option {
+	return func(gh *Gulter) {
+		gh.maxRequestSize = i
+	}
+}
+
+// WithMaxFilesPerField limits how many files can be uploaded in a single
+// form field
+func WithMaxFilesPerField(i int) Option {
+	return func(gh *Gulter) {
+		gh.maxFilesPerField = i
+	}
+}
+
+// WithMaxFilesPerRequest limits how many files can be uploaded in a
+// single request across all form fields
+func WithMaxFilesPerRequest(i int) Option {
+	return func(gh *Gulter) {
+		gh.maxFilesPerRequest = i
 	}
 }
 
 func WithValidationFunc(validationFunc ValidationFunc) Option {
 	return func(g *Gulter) {
-		g.validationFunc = validationFunc
+		g.validator = validationFunc
+	}
+}
+
+// WithValidator allows you validate files with access to their content, the
+// HTTP request and the request context
+func WithValidator(validator Validator) Option {
+	return func(g *Gulter) {
+		g.validator = validator
+	}
+}
+
+// WithMimeDetector configures how the mimetype of uploaded files is detected.
+// The default relies on http.DetectContentType, use NewSignatureMimeDetector
+// to recognize more formats like Office documents, HEIC or AVIF images
+func WithMimeDetector(detector MimeDetector) Option {
+	return func(g *Gulter) {
+		g.mimeDetector = detector
+	}
+}
+
+// WithContentTypeCheck rejects files whose extension or the Content-Type
+// declared by the client contradicts the mimetype detected from their content,
+// like an HTML file uploaded as invoice.pdf
+func WithContentTypeCheck(check ContentTypeCheck) Option {
+	return func(g *Gulter) {
+		g.contentTypeCheck = check
 	}
 }
 
@@ -69,3 +146,35 @@ func WithErrorResponseHandler(errHandler ErrResponseHandler) Option {
 		g.errorResponseHandler = errHandler
 	}
 }
+
+// WithProblemDetails writes errors as RFC 7807 application/problem+json
+// responses instead of the default JSON body.
+// Options are applied in order, so whichever of this and
+// WithErrorResponseHandler comes last takes effect
+func WithProblemDetails(enabled bool) Option {
+	return func(g *Gulter) {
+		if enabled {
+			g.errorResponseHandler = problemDetailsResponseHandler
+		}
+	}
+}
+
+// WithRollbackOnError makes uploads transactional. If any file in a request
+// fails validation or cannot be stored, every file that was already stored
+// during that request is deleted from the storage backend
+func WithRollbackOnError(rollback bool) Option {
+	return func(g *Gulter) {
+		g.rollbackOnError = rollback
+	}
+}
+
+// WithStreamingUploads reads the files directly from the request body and pipes
+// them to the storage backend as they arrive instead of parsing the entire
+// multipart form into memory and temporary files first.
+// This keeps memory and disk usage flat regardless of the size of the uploads
+// but files are processed one after the other in the order the client sent them
+func WithStreamingUploads(stream bool) Option {
+	return func(g *Gulter) {
+		g.streamUploads = stream
+	}
+}
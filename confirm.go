@@ -0,0 +1,167 @@
+package gulter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// ErrUnexpectedKey is returned by ConfirmUpload if the key sent by the client
+// is not the one that was issued for the upload
+const ErrUnexpectedKey = errorMsg("gulter: key was not issued for this upload")
+
+// UploadKey is the key a client was allowed to upload a file to. With a
+// Prefix, the client picks the rest of the key
+type UploadKey struct {
+	Key    string
+	Prefix string
+}
+
+// allows reports whether the client was allowed to upload to key
+func (u UploadKey) allows(key string) bool {
+	if u.Prefix == "" {
+		return u.Key != "" && key == u.Key
+	}
+
+	name, ok := strings.CutPrefix(key, u.Prefix)
+	if !ok || name == "" {
+		return false
+	}
+
+	// some backends resolve dot segments, which would let the key escape
+	// the prefix
+	return !slices.Contains(strings.Split(name, "/"), "..")
+}
+
+// ConfirmUpload validates a file the client uploaded to the storage backend
+// directly, like with a presigned S3 URL, so it goes through the same checks
+// as files uploaded through the middleware. The details of the file are
+// retrieved from the storage of the field, its mimetype is detected from its
+// first 64KB and the validator of the field is run. Validators can read the
+// first 64KB of the file.
+//
+// expected is the key or key prefix that was issued for the upload. The key
+// sent by the client is rejected with ErrUnexpectedKey if it does not match,
+// without being read or deleted.
+// If the file is rejected, it is deleted from the storage
+func (h *Gulter) ConfirmUpload(r *http.Request, spec FieldSpec, expected UploadKey,
+	key, originalName string,
+) (File, error) {
+	if !expected.allows(key) {
+		return File{}, &ValidationError{
+			FieldName: spec.Name,
+			FileName:  originalName,
+			Err:       fmt.Errorf("%w (%s)", ErrUnexpectedKey, key),
+		}
+	}
+
+	field := h.fieldSpec(spec)
+	ctx := r.Context()
+
+	file, err := h.confirmUpload(r, field, key, originalName)
+	if err != nil {
+		var validationErr *ValidationError
+		var sizeErr *SizeLimitError
+
+		if errors.As(err, &validationErr) || errors.As(err, &sizeErr) {
+			if deleteErr := field.Storage.Delete(context.WithoutCancel(ctx), key); deleteErr != nil {
+				return File{}, errors.Join(err,
+					fmt.Errorf("gulter: could not delete rejected file (%s)...%w", key, deleteErr))
+			}
+		}
+
+		return File{}, err
+	}
+
+	return file, nil
+}
+
+func (h *Gulter) confirmUpload(r *http.Request, field FieldSpec, key, originalName string) (File, error) {
+	info, err := field.Storage.Stat(r.Context(), key)
+	if err != nil {
+		return File{}, err
+	}
+
+	if field.MaxFileSize > 0 && info.Size > field.MaxFileSize {
+		return File{}, &SizeLimitError{
+			FieldName: field.Name,
+			FileName:  originalName,
+			Limit:     field.MaxFileSize,
+		}
+	}
+
+	peeked, err := peekFile(r.Context(), field.Storage, key, min(info.Size, peekLen))
+	if err != nil {
+		return File{}, &StorageError{
+			FieldName: field.Name,
+			FileName:  originalName,
+			Err:       err,
+		}
+	}
+
+	content := bytes.NewReader(peeked)
+
+	mimeType, err := h.detectMimeType(content)
+	if err != nil {
+		return File{}, fmt.Errorf("gulter: %s has invalid mimetype..%v", field.Name, err)
+	}
+
+	header := &multipart.FileHeader{
+		Filename: originalName,
+		Header:   textproto.MIMEHeader{},
+		Size:     info.Size,
+	}
+
+	if info.ContentType != "" {
+		header.Header.Set("Content-Type", info.ContentType)
+	}
+
+	fileData := File{
+		FieldName:         field.Name,
+		OriginalName:      originalName,
+		UploadedFileName:  key,
+		FolderDestination: info.FolderDestination,
+		StorageKey:        key,
+		MimeType:          mimeType,
+		Size:              info.Size,
+	}
+
+	if err := h.validate(r, field, fileData, header, content); err != nil {
+		return File{}, err
+	}
+
+	return fileData, nil
+}
+
+// peekFile retrieves the first n bytes of a file. Only those bytes are
+// requested from backends that implement RangeStorage, others have the rest
+// of the file discarded
+func peekFile(ctx context.Context, storage Storage, key string, n int64) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var rc io.ReadCloser
+	var err error
+
+	if rangeStorage, ok := storage.(RangeStorage); ok {
+		rc, err = rangeStorage.GetRange(ctx, key, 0, n)
+	} else {
+		rc, _, err = storage.Get(ctx, key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, n))
+}
@@ -0,0 +1,279 @@
+package gulter_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/adelowo/gulter/mocks"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGulter_ConfirmUpload(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name               string
+		content            []byte
+		spec               gulter.FieldSpec
+		deleted            bool
+		expectedStatusCode int
+	}{
+		{
+			name:    "valid file",
+			content: image,
+			spec: gulter.FieldSpec{
+				Name:      "avatar",
+				Validator: gulter.MimeTypeValidator("image/jpeg"),
+			},
+		},
+		{
+			name:    "invalid mimetype",
+			content: []byte("<html><script>alert(1)</script></html>"),
+			spec: gulter.FieldSpec{
+				Name:      "avatar",
+				Validator: gulter.MimeTypeValidator("image/jpeg"),
+			},
+			deleted:            true,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:    "file is too large",
+			content: image,
+			spec: gulter.FieldSpec{
+				Name:        "avatar",
+				MaxFileSize: 1024,
+			},
+			deleted:            true,
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorage(ctrl)
+
+			info := &gulter.FileInfo{
+				Key:               "uploads/avatar.jpg",
+				Size:              int64(len(v.content)),
+				ContentType:       "image/jpeg",
+				FolderDestination: "uploads-bucket",
+			}
+
+			storage.EXPECT().
+				Stat(gomock.Any(), "uploads/avatar.jpg").
+				Return(info, nil).
+				Times(1)
+
+			// files that are too large are rejected without being read
+			getCalls := 1
+			if v.expectedStatusCode == http.StatusRequestEntityTooLarge {
+				getCalls = 0
+			}
+
+			storage.EXPECT().
+				Get(gomock.Any(), "uploads/avatar.jpg").
+				Return(io.NopCloser(strings.NewReader(string(v.content))), info, nil).
+				Times(getCalls)
+
+			deleteCalls := 0
+			if v.deleted {
+				deleteCalls = 1
+			}
+
+			storage.EXPECT().
+				Delete(gomock.Any(), "uploads/avatar.jpg").
+				Return(nil).
+				Times(deleteCalls)
+
+			handler, err := gulter.New(gulter.WithStorage(storage))
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/confirm", nil)
+
+			file, err := handler.ConfirmUpload(r, v.spec, gulter.UploadKey{Key: "uploads/avatar.jpg"},
+				"uploads/avatar.jpg", "avatar.jpg")
+			if v.expectedStatusCode != 0 {
+				require.Error(t, err)
+				require.Equal(t, v.expectedStatusCode, gulter.ErrorStatusCode(err))
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, gulter.File{
+				FieldName:         "avatar",
+				OriginalName:      "avatar.jpg",
+				UploadedFileName:  "uploads/avatar.jpg",
+				FolderDestination: "uploads-bucket",
+				StorageKey:        "uploads/avatar.jpg",
+				MimeType:          "image/jpeg",
+				Size:              int64(len(image)),
+			}, file)
+		})
+	}
+}
+
+func TestGulter_ConfirmUploadMissingFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Stat(gomock.Any(), "uploads/avatar.jpg").
+		Return(nil, errors.Join(errors.New("no such key"), gulter.ErrFileNotFound)).
+		Times(1)
+
+	handler, err := gulter.New(gulter.WithStorage(storage))
+	require.NoError(t, err)
+
+	_, err = handler.ConfirmUpload(httptest.NewRequest(http.MethodPost, "/", nil),
+		gulter.FieldSpec{Name: "avatar"}, gulter.UploadKey{Key: "uploads/avatar.jpg"},
+		"uploads/avatar.jpg", "avatar.jpg")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestGulter_ConfirmUploadUnexpectedKey(t *testing.T) {
+	tt := []struct {
+		name     string
+		expected gulter.UploadKey
+		key      string
+	}{
+		{
+			name:     "key of another upload",
+			expected: gulter.UploadKey{Key: "uploads/lanre/avatar.jpg"},
+			key:      "uploads/ayinke/avatar.jpg",
+		},
+		{
+			name:     "key outside the prefix",
+			expected: gulter.UploadKey{Prefix: "uploads/lanre/"},
+			key:      "uploads/ayinke/avatar.jpg",
+		},
+		{
+			name:     "key escapes the prefix",
+			expected: gulter.UploadKey{Prefix: "uploads/lanre/"},
+			key:      "uploads/lanre/../ayinke/avatar.jpg",
+		},
+		{
+			name:     "prefix without a file name",
+			expected: gulter.UploadKey{Prefix: "uploads/lanre/"},
+			key:      "uploads/lanre/",
+		},
+		{
+			name: "no key was issued",
+			key:  "uploads/ayinke/avatar.jpg",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// the file must be neither read nor deleted
+			storage := mocks.NewMockStorage(ctrl)
+
+			handler, err := gulter.New(gulter.WithStorage(storage))
+			require.NoError(t, err)
+
+			_, err = handler.ConfirmUpload(httptest.NewRequest(http.MethodPost, "/", nil),
+				gulter.FieldSpec{
+					Name:      "avatar",
+					Validator: gulter.MimeTypeValidator("image/jpeg"),
+				}, v.expected, v.key, "avatar.jpg")
+			require.ErrorIs(t, err, gulter.ErrUnexpectedKey)
+			require.Equal(t, http.StatusBadRequest, gulter.ErrorStatusCode(err))
+		})
+	}
+}
+
+func TestGulter_ConfirmUploadKeyPrefix(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	info := &gulter.FileInfo{
+		Key:  "uploads/lanre/avatar.jpg",
+		Size: int64(len(image)),
+	}
+
+	storage.EXPECT().
+		Stat(gomock.Any(), "uploads/lanre/avatar.jpg").
+		Return(info, nil).
+		Times(1)
+
+	storage.EXPECT().
+		Get(gomock.Any(), "uploads/lanre/avatar.jpg").
+		Return(io.NopCloser(strings.NewReader(string(image))), info, nil).
+		Times(1)
+
+	handler, err := gulter.New(gulter.WithStorage(storage))
+	require.NoError(t, err)
+
+	file, err := handler.ConfirmUpload(httptest.NewRequest(http.MethodPost, "/", nil),
+		gulter.FieldSpec{Name: "avatar"}, gulter.UploadKey{Prefix: "uploads/lanre/"},
+		"uploads/lanre/avatar.jpg", "avatar.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "uploads/lanre/avatar.jpg", file.StorageKey)
+}
+
+// rangeStorage is a storage backend that can retrieve part of a file
+type rangeStorage struct {
+	*mocks.MockStorage
+	*mocks.MockRangeStorage
+}
+
+func TestGulter_ConfirmUploadRange(t *testing.T) {
+	content := append([]byte("%PDF-1.7\n"), make([]byte, 128*1024)...)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := rangeStorage{mocks.NewMockStorage(ctrl), mocks.NewMockRangeStorage(ctrl)}
+
+	storage.MockStorage.EXPECT().
+		Stat(gomock.Any(), "uploads/invoice.pdf").
+		Return(&gulter.FileInfo{
+			Key:               "uploads/invoice.pdf",
+			Size:              int64(len(content)),
+			FolderDestination: "uploads-bucket",
+		}, nil).
+		Times(1)
+
+	// only the first 64KB are retrieved to detect the mimetype
+	storage.MockRangeStorage.EXPECT().
+		GetRange(gomock.Any(), "uploads/invoice.pdf", int64(0), int64(64*1024)).
+		Return(io.NopCloser(bytes.NewReader(content[:64*1024])), nil).
+		Times(1)
+
+	storage.MockStorage.EXPECT().
+		Get(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	handler, err := gulter.New(gulter.WithStorage(storage))
+	require.NoError(t, err)
+
+	file, err := handler.ConfirmUpload(httptest.NewRequest(http.MethodPost, "/", nil),
+		gulter.FieldSpec{Name: "invoice"}, gulter.UploadKey{Key: "uploads/invoice.pdf"},
+		"uploads/invoice.pdf", "invoice.pdf")
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", file.MimeType)
+	require.Equal(t, "uploads-bucket", file.FolderDestination)
+	require.Equal(t, int64(len(content)), file.Size)
+}
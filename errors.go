@@ -0,0 +1,312 @@
+package gulter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+)
+
+// ValidationError is returned when a file is rejected by the configured
+// validation rules
+type ValidationError struct {
+	FieldName string
+	FileName  string
+	Err       error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("gulter: validation failed for (%s)...%v", e.FieldName, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// MimeTypeError is returned when the mimetype of a file is not supported
+type MimeTypeError struct {
+	MimeType string
+	Allowed  []string
+}
+
+func (e *MimeTypeError) Error() string {
+	return fmt.Sprintf("unsupported mime type uploaded..(%s)", e.MimeType)
+}
+
+// ContentTypeMismatchError is returned when the extension of a file or the
+// Content-Type declared by the client contradicts the mimetype detected from
+// its content
+type ContentTypeMismatchError struct {
+	Extension    string
+	DeclaredType string
+	DetectedType string
+}
+
+func (e *ContentTypeMismatchError) Error() string {
+	return fmt.Sprintf("content of file with extension (%s) and declared type (%s) was detected as (%s)",
+		e.Extension, e.DeclaredType, e.DetectedType)
+}
+
+// MissingFieldError is returned when a configured form field does not
+// contain any file in the request
+type MissingFieldError struct {
+	FieldName string
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("files could not be found in key (%s) from http request", e.FieldName)
+}
+
+// FileCountError is returned when a form field contains fewer or more files
+// than allowed. FieldName is empty if the limit applies to the entire request
+type FileCountError struct {
+	FieldName string
+	Count     int
+	Min       int
+	Max       int
+}
+
+func (e *FileCountError) Error() string {
+	if e.FieldName == "" {
+		return fmt.Sprintf("gulter: request contains more than the allowed %d files", e.Max)
+	}
+
+	if e.Max > 0 && e.Count > e.Max {
+		return fmt.Sprintf("gulter: (%s) contains more than the allowed %d files", e.FieldName, e.Max)
+	}
+
+	return fmt.Sprintf("gulter: (%s) must contain at least %d files", e.FieldName, e.Min)
+}
+
+// SizeLimitError is returned when the request or one of its files is larger
+// than the configured limit. FieldName and FileName are empty if the limit was
+// hit before the file could be identified
+type SizeLimitError struct {
+	FieldName string
+	FileName  string
+	Limit     int64
+	Err       error
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.FieldName == "" {
+		return fmt.Sprintf("gulter: request body is larger than the allowed %d bytes", e.Limit)
+	}
+
+	return fmt.Sprintf("gulter: file (%s) in (%s) is larger than the allowed %d bytes",
+		e.FileName, e.FieldName, e.Limit)
+}
+
+func (e *SizeLimitError) Unwrap() error { return e.Err }
+
+// StorageError is returned when a file could not be copied to the storage
+// backend
+type StorageError struct {
+	FieldName string
+	FileName  string
+	Err       error
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("gulter: could not upload file to storage (%s)...%v", e.FieldName, e.Err)
+}
+
+func (e *StorageError) Unwrap() error { return e.Err }
+
+// ChunkedUploadError is returned when a request that is part of a chunked
+// upload is invalid. Chunk is the index of the rejected chunk or -1 if the
+// error does not concern a single chunk
+type ChunkedUploadError struct {
+	SessionID string
+	Chunk     int
+	Err       error
+}
+
+func (e *ChunkedUploadError) Error() string {
+	if e.Chunk < 0 {
+		return fmt.Sprintf("gulter: invalid chunked upload (%s)...%v", e.SessionID, e.Err)
+	}
+
+	return fmt.Sprintf("gulter: chunk %d of upload (%s) was rejected...%v", e.Chunk, e.SessionID, e.Err)
+}
+
+func (e *ChunkedUploadError) Unwrap() error { return e.Err }
+
+// ErrorStatusCode returns the HTTP status code that best describes
+// an error returned during an upload
+func ErrorStatusCode(err error) int {
+	var sizeErr *SizeLimitError
+	var maxBytesErr *http.MaxBytesError
+	var mimeErr *MimeTypeError
+	var mismatchErr *ContentTypeMismatchError
+	var validationErr *ValidationError
+	var missingFieldErr *MissingFieldError
+	var fileCountErr *FileCountError
+	var storageErr *StorageError
+	var chunkedErr *ChunkedUploadError
+
+	switch {
+	case errors.As(err, &sizeErr), errors.As(err, &maxBytesErr),
+		errors.Is(err, multipart.ErrMessageTooLarge):
+		return http.StatusRequestEntityTooLarge
+
+	case errors.As(err, &mimeErr), errors.As(err, &mismatchErr):
+		return http.StatusUnsupportedMediaType
+
+	case errors.As(err, &validationErr), errors.As(err, &missingFieldErr),
+		errors.As(err, &fileCountErr),
+		errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary):
+		return http.StatusBadRequest
+
+	case errors.Is(err, ErrUploadExpired):
+		return http.StatusGone
+
+	case errors.Is(err, ErrUploadIncomplete):
+		return http.StatusConflict
+
+	case errors.As(err, &chunkedErr):
+		return http.StatusBadRequest
+
+	case errors.Is(err, ErrFileNotFound):
+		return http.StatusNotFound
+
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusForbidden
+
+	case errors.As(err, &storageErr):
+		return http.StatusBadGateway
+
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Machine readable codes that describe why an upload failed
+const (
+	ErrorCodeSizeLimitExceeded    = "size_limit_exceeded"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeContentTypeMismatch  = "content_type_mismatch"
+	ErrorCodeValidationFailed     = "validation_failed"
+	ErrorCodeMissingField         = "missing_field"
+	ErrorCodeInvalidFileCount     = "invalid_file_count"
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeStorageFailed        = "storage_failed"
+	ErrorCodeFileNotFound         = "file_not_found"
+	ErrorCodeInvalidSignature     = "invalid_signature"
+	ErrorCodeChecksumMismatch     = "checksum_mismatch"
+	ErrorCodeUploadExpired        = "upload_expired"
+	ErrorCodeUploadIncomplete     = "upload_incomplete"
+	ErrorCodeInternal             = "internal_error"
+)
+
+// ErrorCode returns a machine readable code that describes an error
+// returned during an upload
+func ErrorCode(err error) string {
+	switch ErrorStatusCode(err) {
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodeSizeLimitExceeded
+	case http.StatusUnsupportedMediaType:
+		var mismatchErr *ContentTypeMismatchError
+		if errors.As(err, &mismatchErr) {
+			return ErrorCodeContentTypeMismatch
+		}
+
+		return ErrorCodeUnsupportedMediaType
+	case http.StatusBadGateway:
+		return ErrorCodeStorageFailed
+	case http.StatusNotFound:
+		return ErrorCodeFileNotFound
+	case http.StatusForbidden:
+		return ErrorCodeInvalidSignature
+	case http.StatusGone:
+		return ErrorCodeUploadExpired
+	case http.StatusConflict:
+		return ErrorCodeUploadIncomplete
+	case http.StatusBadRequest:
+		var validationErr *ValidationError
+		var missingFieldErr *MissingFieldError
+		var fileCountErr *FileCountError
+
+		switch {
+		case errors.As(err, &validationErr):
+			return ErrorCodeValidationFailed
+		case errors.As(err, &missingFieldErr):
+			return ErrorCodeMissingField
+		case errors.As(err, &fileCountErr):
+			return ErrorCodeInvalidFileCount
+		case errors.Is(err, ErrChecksumMismatch):
+			return ErrorCodeChecksumMismatch
+		default:
+			return ErrorCodeInvalidRequest
+		}
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// errorDetails retrieves the form field and file name that caused an error
+// if available
+func errorDetails(err error) (fieldName, fileName string) {
+	var validationErr *ValidationError
+	var missingFieldErr *MissingFieldError
+	var sizeErr *SizeLimitError
+	var fileCountErr *FileCountError
+	var storageErr *StorageError
+
+	switch {
+	case errors.As(err, &sizeErr):
+		return sizeErr.FieldName, sizeErr.FileName
+	case errors.As(err, &fileCountErr):
+		return fileCountErr.FieldName, ""
+	case errors.As(err, &validationErr):
+		return validationErr.FieldName, validationErr.FileName
+	case errors.As(err, &missingFieldErr):
+		return missingFieldErr.FieldName, ""
+	case errors.As(err, &storageErr):
+		return storageErr.FieldName, storageErr.FileName
+	default:
+		return "", ""
+	}
+}
+
+// ErrorResponse is the JSON body written by the default error
+// response handler
+type ErrorResponse struct {
+	Message   string `json:"message"`
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	FieldName string `json:"field,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+}
+
+// ProblemDetails is an RFC 7807 representation of an upload error
+type ProblemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Code      string `json:"code"`
+	FieldName string `json:"field,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+}
+
+// sizeLimitError converts the error returned by http.MaxBytesReader into
+// a SizeLimitError. If err is not a size error, it is returned as is
+func sizeLimitError(err error, fieldName, fileName string) error {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return err
+	}
+
+	return &SizeLimitError{
+		FieldName: fieldName,
+		FileName:  fileName,
+		Limit:     maxBytesErr.Limit,
+		Err:       err,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
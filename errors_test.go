@@ -0,0 +1,118 @@
+package gulter_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorStatusCode(t *testing.T) {
+	tt := []struct {
+		name               string
+		err                error
+		expectedStatusCode int
+	}{
+		{
+			name: "size limit errors",
+			err: &gulter.SizeLimitError{
+				FieldName: "avatar",
+				Limit:     1024,
+			},
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:               "errors from http.MaxBytesReader",
+			err:                fmt.Errorf("multipart: NextPart: %w", &http.MaxBytesError{Limit: 1024}),
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "unsupported mimetypes",
+			err: &gulter.ValidationError{
+				FieldName: "avatar",
+				Err:       &gulter.MimeTypeError{MimeType: "text/plain"},
+			},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "extensions that contradict the content",
+			err: &gulter.ValidationError{
+				FieldName: "invoice",
+				Err: &gulter.ContentTypeMismatchError{
+					Extension:    ".pdf",
+					DeclaredType: "application/pdf",
+					DetectedType: "text/html",
+				},
+			},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "validation errors",
+			err: &gulter.ValidationError{
+				FieldName: "avatar",
+				Err:       errors.New("file is too small"),
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "missing form fields",
+			err:                &gulter.MissingFieldError{FieldName: "avatar"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "requests that are not multipart",
+			err:                http.ErrNotMultipart,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "storage errors even after a failed rollback",
+			err: errors.Join(&gulter.StorageError{
+				FieldName: "avatar",
+				Err:       errors.New("bucket does not exist"),
+			}, errors.New("could not roll back uploaded file")),
+			expectedStatusCode: http.StatusBadGateway,
+		},
+		{
+			name:               "files that do not exist",
+			err:                fmt.Errorf("open gulter.txt: no such file...%w", gulter.ErrFileNotFound),
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name: "chunks that do not match their checksum",
+			err: &gulter.ChunkedUploadError{
+				SessionID: "f00d",
+				Chunk:     2,
+				Err:       gulter.ErrChecksumMismatch,
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "chunked uploads that are not complete",
+			err: &gulter.ChunkedUploadError{
+				SessionID: "f00d",
+				Chunk:     -1,
+				Err:       fmt.Errorf("%w: missing chunks [1]", gulter.ErrUploadIncomplete),
+			},
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "expired uploads",
+			err:                &gulter.ChunkedUploadError{SessionID: "f00d", Chunk: -1, Err: gulter.ErrUploadExpired},
+			expectedStatusCode: http.StatusGone,
+		},
+		{
+			name:               "unknown errors",
+			err:                errors.New("unknown error"),
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			require.Equal(t, v.expectedStatusCode, gulter.ErrorStatusCode(v.err))
+		})
+	}
+}
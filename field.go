@@ -0,0 +1,93 @@
+package gulter
+
+import (
+	"io"
+	"net/http"
+)
+
+// FieldSpec configures how the files in a single form field are handled.
+// Any value that is not provided falls back to the options the Gulter
+// instance was created with
+type FieldSpec struct {
+	// Name of the form field
+	Name string
+
+	// MaxFileSize is the largest size in bytes allowed for each file in
+	// this field. The size of the entire request is still limited by
+	// WithMaxRequestSize. Defaults to WithMaxFileSize
+	MaxFileSize int64
+
+	// MinFiles is the least amount of files the field must contain if it
+	// is present in the request
+	MinFiles int
+
+	// MaxFiles is the most amount of files the field can contain.
+	// Defaults to WithMaxFilesPerField
+	MaxFiles int
+
+	Validator     Validator
+	NameGenerator NameGeneratorFunc
+	Storage       Storage
+
+	// Required fails the request if the field does not exist
+	Required bool
+}
+
+// fieldSpec fills in the values that were not provided with the
+// instance wide configuration
+func (h *Gulter) fieldSpec(spec FieldSpec) FieldSpec {
+	if spec.MaxFileSize <= 0 {
+		spec.MaxFileSize = h.maxFileSize
+	}
+
+	if spec.MaxFiles <= 0 {
+		spec.MaxFiles = h.maxFilesPerField
+	}
+
+	if spec.Validator == nil {
+		spec.Validator = h.validator
+	}
+
+	if spec.NameGenerator == nil {
+		spec.NameGenerator = h.nameFuncGenerator
+	}
+
+	if spec.Storage == nil {
+		spec.Storage = h.storage
+	}
+
+	return spec
+}
+
+// checkCount makes sure the amount of files in a field is within the
+// configured limits
+func (spec FieldSpec) checkCount(count int) error {
+	if (spec.MaxFiles > 0 && count > spec.MaxFiles) || count < spec.MinFiles {
+		return &FileCountError{
+			FieldName: spec.Name,
+			Count:     count,
+			Min:       spec.MinFiles,
+			Max:       spec.MaxFiles,
+		}
+	}
+
+	return nil
+}
+
+// sizeLimitReader fails once more than limit bytes have been read from it
+type sizeLimitReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (s *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+
+	if s.read > s.limit {
+		return n, &http.MaxBytesError{Limit: s.limit}
+	}
+
+	return n, err
+}
@@ -1,11 +1,15 @@
 package gulter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -47,7 +51,11 @@ type NameGeneratorFunc func(s string) string
 
 type Gulter struct {
 	storage Storage
-	maxSize int64
+
+	maxRequestSize     int64
+	maxFileSize        int64
+	maxFilesPerField   int
+	maxFilesPerRequest int
 
 	// when you configure the middleware, you usually provide a list of
 	// keys to retrieve the files from. If any of these keys do not exists,
@@ -55,9 +63,20 @@ type Gulter struct {
 	// If this option is set to true, the value is just skipped instead
 	ignoreNonExistentKeys bool
 
-	validationFunc       ValidationFunc
+	validator            Validator
+	mimeDetector         MimeDetector
+	contentTypeCheck     ContentTypeCheck
 	nameFuncGenerator    NameGeneratorFunc
 	errorResponseHandler ErrResponseHandler
+
+	// if enabled, all files stored during a request will be deleted
+	// if any file in that same request fails to be uploaded
+	rollbackOnError bool
+
+	// if enabled, files are read directly from the request body and sent to
+	// the storage backend one after the other instead of buffering the
+	// entire multipart form first
+	streamUploads bool
 }
 
 func New(opts ...Option) (*Gulter, error) {
@@ -67,12 +86,22 @@ func New(opts ...Option) (*Gulter, error) {
 		opt(handler)
 	}
 
-	if handler.maxSize <= 0 {
-		handler.maxSize = defaultFileUploadMaxSize
+	if handler.maxFileSize <= 0 {
+		handler.maxFileSize = defaultFileUploadMaxSize
+	}
+
+	// earlier releases only had a single limit for the entire request, so
+	// we keep that behaviour if a request limit was not explicitly provided
+	if handler.maxRequestSize <= 0 {
+		handler.maxRequestSize = handler.maxFileSize
 	}
 
-	if handler.validationFunc == nil {
-		handler.validationFunc = defaultValidationFunc
+	if handler.validator == nil {
+		handler.validator = defaultValidationFunc
+	}
+
+	if handler.mimeDetector == nil {
+		handler.mimeDetector = defaultMimeDetector
 	}
 
 	if handler.nameFuncGenerator == nil {
@@ -95,89 +124,278 @@ func (g *Gulter) Storage() Storage { return g.storage }
 // Upload is a HTTP middleware that takes in a list of form fields and the next
 // HTTP handler to run after the upload prodcess is completed
 func (h *Gulter) Upload(keys ...string) func(next http.Handler) http.Handler {
+	fields := make([]FieldSpec, 0, len(keys))
+
+	for _, key := range keys {
+		fields = append(fields, FieldSpec{
+			Name:     key,
+			Required: !h.ignoreNonExistentKeys,
+		})
+	}
+
+	return h.UploadFields(fields...)
+}
+
+// UploadFields is a HTTP middleware like Upload but it allows you configure
+// the size limits, amount of files, validation, naming and storage of each
+// form field individually
+func (h *Gulter) UploadFields(specs ...FieldSpec) func(next http.Handler) http.Handler {
+	fields := make([]FieldSpec, 0, len(specs))
+
+	for _, spec := range specs {
+		fields = append(fields, h.fieldSpec(spec))
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r.Body = http.MaxBytesReader(w, r.Body, h.maxSize)
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxRequestSize)
+
+			var uploadedFiles Files
+			var err error
+
+			if h.streamUploads {
+				uploadedFiles, err = h.streamFiles(r, fields)
+			} else {
+				uploadedFiles, err = h.parseFiles(r, fields)
+			}
 
-			err := r.ParseMultipartForm(h.maxSize)
 			if err != nil {
+				if h.rollbackOnError {
+					err = h.rollback(context.WithoutCancel(r.Context()), err, uploadedFiles, fields)
+				}
+
 				h.errorResponseHandler(err).ServeHTTP(w, r)
 				return
 			}
 
-			var wg errgroup.Group
+			r = r.WithContext(writeFilesToContext(r.Context(), uploadedFiles))
 
-			uploadedFiles := make(Files, len(keys))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			for _, key := range keys {
-				// TODO(adelowo): remove this when we drop support for < 1.22
-				func(key string) {
-					wg.Go(func() error {
+// parseFiles buffers the entire multipart form before uploading the files.
+// Even if an error occurs, all files that made it to the storage are returned
+func (h *Gulter) parseFiles(r *http.Request, fields []FieldSpec) (Files, error) {
+	err := r.ParseMultipartForm(h.maxRequestSize)
+	if err != nil {
+		return nil, sizeLimitError(err, "", "")
+	}
 
-						fileHeaders, ok := r.MultipartForm.File[key]
-						if !ok {
-							if h.ignoreNonExistentKeys {
-								return nil
-							}
+	if h.maxFilesPerRequest > 0 {
+		var count int
+		for _, fileHeaders := range r.MultipartForm.File {
+			count += len(fileHeaders)
+		}
 
-							return fmt.Errorf("files could not be found in key (%s) from http request", key)
-						}
+		if count > h.maxFilesPerRequest {
+			return nil, &FileCountError{
+				Count: count,
+				Max:   h.maxFilesPerRequest,
+			}
+		}
+	}
 
-						uploadedFiles[key] = make([]File, 0, len(fileHeaders))
+	var wg errgroup.Group
+	var mu sync.Mutex
 
-						for _, header := range fileHeaders {
+	uploadedFiles := make(Files, len(fields))
 
-							f, err := header.Open()
+	for _, field := range fields {
+		// TODO(adelowo): remove this when we drop support for < 1.22
+		func(field FieldSpec) {
+			wg.Go(func() error {
 
-							defer f.Close()
+				fileHeaders, ok := r.MultipartForm.File[field.Name]
+				if !ok {
+					if !field.Required {
+						return nil
+					}
 
-							uploadedFileName := h.nameFuncGenerator(header.Filename)
+					return &MissingFieldError{FieldName: field.Name}
+				}
 
-							mimeType, err := fetchContentType(f)
-							if err != nil {
-								return fmt.Errorf("gulter: %s has invalid mimetype..%v", key, err)
-							}
+				if err := field.checkCount(len(fileHeaders)); err != nil {
+					return err
+				}
 
-							fileData := File{
-								FieldName:        key,
-								OriginalName:     header.Filename,
-								UploadedFileName: uploadedFileName,
-								MimeType:         mimeType,
-							}
+				files := make([]File, 0, len(fileHeaders))
 
-							if err := h.validationFunc(fileData); err != nil {
-								return fmt.Errorf("gulter: validation failed for (%s)...%v", key, err)
-							}
+				defer func() {
+					mu.Lock()
+					defer mu.Unlock()
 
-							metadata, err := h.storage.Upload(r.Context(), f, &UploadFileOptions{
-								FileName: uploadedFileName,
-							})
-							if err != nil {
-								return fmt.Errorf("gulter: could not upload file to storage (%s)...%v", key, err)
-							}
+					uploadedFiles[field.Name] = files
+				}()
 
-							fileData.Size = metadata.Size
-							fileData.FolderDestination = metadata.FolderDestination
-							fileData.StorageKey = metadata.Key
+				for _, header := range fileHeaders {
 
-							uploadedFiles[key] = append(uploadedFiles[key], fileData)
+					if field.MaxFileSize > 0 && header.Size > field.MaxFileSize {
+						return &SizeLimitError{
+							FieldName: field.Name,
+							FileName:  header.Filename,
+							Limit:     field.MaxFileSize,
 						}
+					}
 
-						return nil
-					})
-				}(key)
-			}
+					f, err := header.Open()
+					if err != nil {
+						return fmt.Errorf("gulter: could not open file (%s)...%v", field.Name, err)
+					}
 
-			if err := wg.Wait(); err != nil {
-				h.errorResponseHandler(err).ServeHTTP(w, r)
-				return
+					defer f.Close()
+
+					mimeType, err := h.detectMimeType(f)
+					if err != nil {
+						return fmt.Errorf("gulter: %s has invalid mimetype..%v", field.Name, err)
+					}
+
+					fileData, err := h.uploadFile(r, field, header, mimeType, f, f)
+					if err != nil {
+						return err
+					}
+
+					files = append(files, fileData)
+				}
+
+				return nil
+			})
+		}(field)
+	}
+
+	return uploadedFiles, wg.Wait()
+}
+
+// uploadFile validates and copies a single file to the storage backend.
+// content is made available to the validators while body is what is
+// ultimately sent to the storage backend
+func (h *Gulter) uploadFile(req *http.Request, field FieldSpec, header *multipart.FileHeader,
+	mimeType string, content io.ReadSeeker, body io.Reader,
+) (File, error) {
+	ctx := req.Context()
+	originalName := header.Filename
+
+	uploadedFileName := field.NameGenerator(originalName)
+
+	fileData := File{
+		FieldName:        field.Name,
+		OriginalName:     originalName,
+		UploadedFileName: uploadedFileName,
+		MimeType:         mimeType,
+	}
+
+	if header.Size >= 0 {
+		fileData.Size = header.Size
+	}
+
+	if err := h.validate(req, field, fileData, header, content); err != nil {
+		return File{}, err
+	}
+
+	// validators might have read the file
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return File{}, err
+	}
+
+	if field.MaxFileSize > 0 {
+		body = &sizeLimitReader{r: body, limit: field.MaxFileSize}
+	}
+
+	reader := &uploadReader{r: body}
+
+	metadata, err := field.Storage.Upload(ctx, reader, &UploadFileOptions{
+		FileName:    uploadedFileName,
+		ContentType: mimeType,
+		Metadata: map[string]string{
+			MetadataOriginalName: url.PathEscape(originalName),
+		},
+	})
+	if err != nil {
+		// storage backends do not always wrap the errors from the reader,
+		// so a request that was too large could otherwise be reported as
+		// a storage failure
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(reader.err, &maxBytesErr) {
+			return File{}, sizeLimitError(reader.err, field.Name, originalName)
+		}
+
+		return File{}, &StorageError{
+			FieldName: field.Name,
+			FileName:  originalName,
+			Err:       err,
+		}
+	}
+
+	fileData.Size = reader.read
+	if metadata.Size > 0 {
+		fileData.Size = metadata.Size
+	}
+
+	fileData.FolderDestination = metadata.FolderDestination
+	fileData.StorageKey = metadata.Key
+
+	return fileData, nil
+}
+
+// rollback removes all files that were already stored during a failed
+// request. Failures to remove a file are reported alongside the original error
+func (h *Gulter) rollback(ctx context.Context, err error,
+	uploadedFiles Files, fields []FieldSpec,
+) error {
+	errs := []error{err}
+
+	for _, field := range fields {
+		for _, file := range uploadedFiles[field.Name] {
+			if deleteErr := field.Storage.Delete(ctx, file.StorageKey); deleteErr != nil {
+				errs = append(errs,
+					fmt.Errorf("gulter: could not roll back uploaded file (%s)...%v", file.StorageKey, deleteErr))
 			}
+		}
+	}
 
-			r = r.WithContext(writeFilesToContext(r.Context(), uploadedFiles))
+	return errors.Join(errs...)
+}
 
-			next.ServeHTTP(w, r)
+// validate makes sure the file matches its declared type and runs the
+// validator of the field
+func (h *Gulter) validate(req *http.Request, field FieldSpec, file File,
+	header *multipart.FileHeader, content io.ReadSeeker,
+) error {
+	err := h.contentTypeCheck.check(file.OriginalName, header.Header.Get("Content-Type"), file.MimeType)
+	if err == nil {
+		err = field.Validator.Validate(req.Context(), &ValidationInput{
+			File:    file,
+			Request: req,
+			Header:  header,
+			Content: content,
 		})
 	}
+
+	if err != nil {
+		return &ValidationError{
+			FieldName: field.Name,
+			FileName:  file.OriginalName,
+			Err:       err,
+		}
+	}
+
+	return nil
+}
+
+// detectMimeType detects the mimetype of a file with the configured
+// MimeDetector and makes sure the file can be read from the start again
+func (h *Gulter) detectMimeType(f io.ReadSeeker) (string, error) {
+	mimeType, err := h.mimeDetector.Detect(f)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return mimeType, nil
 }
 
 func fetchContentType(f io.ReadSeeker) (string, error) {
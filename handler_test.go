@@ -2,6 +2,7 @@ package gulter_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"testing"
@@ -50,6 +52,10 @@ func TestGulter(t *testing.T) {
 		ignoreFormField bool
 
 		useIgnoreSkipOpt bool
+
+		useStreamingOpt bool
+
+		useProblemDetailsOpt bool
 	}{
 		{
 			name:        "uploading succeeds",
@@ -77,7 +83,7 @@ func TestGulter(t *testing.T) {
 					}, errors.New("could not upload file")).
 					Times(0) // make sure this is never called
 			},
-			expectedStatusCode: http.StatusInternalServerError,
+			expectedStatusCode: http.StatusBadRequest,
 			pathToFile:         "gulter.md",
 			validMimeTypes:     []string{"image/png", "application/pdf"},
 			ignoreFormField:    true,
@@ -111,7 +117,7 @@ func TestGulter(t *testing.T) {
 					}, errors.New("could not upload file")).
 					Times(0) // make sure this is never called
 			},
-			expectedStatusCode: http.StatusInternalServerError,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
 			pathToFile:         "gulter.md",
 			validMimeTypes:     []string{"image/png", "application/pdf"},
 		},
@@ -126,7 +132,7 @@ func TestGulter(t *testing.T) {
 					}, errors.New("could not upload file")).
 					Times(1)
 			},
-			expectedStatusCode: http.StatusInternalServerError,
+			expectedStatusCode: http.StatusBadGateway,
 			pathToFile:         "gulter.md",
 			validMimeTypes:     []string{"text/markdown", "text/plain"},
 		},
@@ -141,10 +147,85 @@ func TestGulter(t *testing.T) {
 					}, errors.New("could not upload file")).
 					Times(0) // never call this
 			},
-			expectedStatusCode: http.StatusInternalServerError,
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
 			pathToFile:         "image.jpg",
 			validMimeTypes:     []string{"image/jpeg"},
 		},
+		{
+			name:        "uploading succeeds when streaming",
+			maxFileSize: 1024,
+			fn: func(store *mocks.MockStorage, size int64) {
+				store.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, r io.Reader, _ *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+						n, err := io.Copy(io.Discard, r)
+						require.NoError(t, err)
+						require.Equal(t, size, n)
+
+						return &gulter.UploadedFileMetadata{
+							Size: n,
+						}, nil
+					}).
+					Times(1)
+			},
+			expectedStatusCode: http.StatusAccepted,
+			pathToFile:         "gulter.md",
+			validMimeTypes:     []string{"text/markdown", "text/plain"},
+			useStreamingOpt:    true,
+		},
+		{
+			name:        "upload fails because of mimetype validation constraints when streaming",
+			maxFileSize: 1024,
+			fn: func(store *mocks.MockStorage, size int64) {
+				store.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0) // make sure this is never called
+			},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+			pathToFile:         "gulter.md",
+			validMimeTypes:     []string{"image/png", "application/pdf"},
+			useStreamingOpt:    true,
+		},
+		{
+			name:        "upload fails because form field does not exist when streaming",
+			maxFileSize: 1024,
+			fn: func(store *mocks.MockStorage, size int64) {
+				store.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0) // make sure this is never called
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			pathToFile:         "gulter.md",
+			validMimeTypes:     []string{"text/markdown", "text/plain"},
+			ignoreFormField:    true,
+			useStreamingOpt:    true,
+		},
+		{
+			name:        "upload fails because file is too large when streaming",
+			maxFileSize: 1024,
+			fn: func(store *mocks.MockStorage, size int64) {
+				store.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0) // the limit is hit while reading the start of the file
+			},
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+			pathToFile:         "image.jpg",
+			validMimeTypes:     []string{"image/jpeg"},
+			useStreamingOpt:    true,
+		},
+		{
+			name:        "upload fails with problem details",
+			maxFileSize: 1024,
+			fn: func(store *mocks.MockStorage, size int64) {
+				store.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0) // make sure this is never called
+			},
+			expectedStatusCode:   http.StatusUnsupportedMediaType,
+			pathToFile:           "gulter.md",
+			validMimeTypes:       []string{"image/png", "application/pdf"},
+			useProblemDetailsOpt: true,
+		},
 	}
 
 	for _, v := range tt {
@@ -164,6 +245,14 @@ func TestGulter(t *testing.T) {
 				opts = append(opts, gulter.WithIgnoreNonExistentKey(true))
 			}
 
+			if v.useStreamingOpt {
+				opts = append(opts, gulter.WithStreamingUploads(true))
+			}
+
+			if v.useProblemDetailsOpt {
+				opts = append(opts, gulter.WithProblemDetails(true))
+			}
+
 			handler, err := gulter.New(opts...)
 			require.NoError(t, err)
 
@@ -216,3 +305,706 @@ func TestGulter(t *testing.T) {
 		})
 	}
 }
+
+func TestGulter_RollbackOnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&gulter.UploadedFileMetadata{
+			Key:  "gulter.md",
+			Size: 51,
+		}, nil).
+		Times(1)
+
+	storage.EXPECT().
+		Delete(gomock.Any(), "gulter.md").
+		Return(nil).
+		Times(1)
+
+	handler, err := gulter.New(
+		gulter.WithMaxFileSize(1024*1024),
+		gulter.WithStorage(storage),
+		gulter.WithValidationFunc(gulter.MimeTypeValidator("text/plain")),
+		gulter.WithRollbackOnError(true),
+	)
+	require.NoError(t, err)
+
+	buffer := bytes.NewBuffer(nil)
+
+	multipartWriter := multipart.NewWriter(buffer)
+
+	for field, pathToFile := range map[string]string{
+		"document": "gulter.md",
+		"image":    "image.jpg",
+	} {
+		formFieldWriter, err := multipartWriter.CreateFormFile(field, pathToFile)
+		require.NoError(t, err)
+
+		fileToUpload, err := os.Open(filepath.Join("testdata", pathToFile))
+		require.NoError(t, err)
+
+		_, err = io.Copy(formFieldWriter, fileToUpload)
+		require.NoError(t, err)
+
+		require.NoError(t, fileToUpload.Close())
+	}
+
+	require.NoError(t, multipartWriter.Close())
+
+	recorder := httptest.NewRecorder()
+
+	r := httptest.NewRequest(http.MethodPost, "/", buffer)
+	r.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	handler.Upload("document", "image")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called if an upload fails")
+	})).ServeHTTP(recorder, r)
+
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Result().StatusCode)
+	verifyMatch(t, recorder)
+}
+
+type formFile struct {
+	fieldName  string
+	pathToFile string
+}
+
+func newMultipartRequest(t *testing.T, files ...formFile) *http.Request {
+	t.Helper()
+
+	buffer := bytes.NewBuffer(nil)
+
+	multipartWriter := multipart.NewWriter(buffer)
+
+	for _, file := range files {
+		formFieldWriter, err := multipartWriter.CreateFormFile(file.fieldName, file.pathToFile)
+		require.NoError(t, err)
+
+		fileToUpload, err := os.Open(filepath.Join("testdata", file.pathToFile))
+		require.NoError(t, err)
+
+		_, err = io.Copy(formFieldWriter, fileToUpload)
+		require.NoError(t, err)
+
+		require.NoError(t, fileToUpload.Close())
+	}
+
+	require.NoError(t, multipartWriter.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/", buffer)
+	r.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	return r
+}
+
+func TestGulter_UploadFields(t *testing.T) {
+	tt := []struct {
+		name               string
+		files              []formFile
+		fields             func(avatarStore, attachmentStore *mocks.MockStorage) []gulter.FieldSpec
+		expectedStatusCode int
+		useStreamingOpt    bool
+	}{
+		{
+			name: "uploading succeeds with a storage and validator per field",
+			files: []formFile{
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+				{fieldName: "attachments", pathToFile: "gulter.md"},
+				{fieldName: "attachments", pathToFile: "gulter.md"},
+			},
+			fields: func(avatarStore, attachmentStore *mocks.MockStorage) []gulter.FieldSpec {
+				avatarStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&gulter.UploadedFileMetadata{}, nil).
+					Times(1)
+
+				attachmentStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&gulter.UploadedFileMetadata{}, nil).
+					Times(2)
+
+				return []gulter.FieldSpec{
+					{
+						Name:      "avatar",
+						MaxFiles:  1,
+						Validator: gulter.MimeTypeValidator("image/jpeg"),
+						Storage:   avatarStore,
+						Required:  true,
+					},
+					{
+						Name:      "attachments",
+						MaxFiles:  10,
+						Validator: gulter.MimeTypeValidator("text/plain"),
+						Storage:   attachmentStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name: "upload fails because the field contains too many files",
+			files: []formFile{
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+			},
+			fields: func(avatarStore, _ *mocks.MockStorage) []gulter.FieldSpec {
+				avatarStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+
+				return []gulter.FieldSpec{
+					{
+						Name:     "avatar",
+						MaxFiles: 1,
+						Storage:  avatarStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "upload fails because the field contains too many files when streaming",
+			files: []formFile{
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+			},
+			fields: func(avatarStore, _ *mocks.MockStorage) []gulter.FieldSpec {
+				// the first file is uploaded before we know there are more
+				avatarStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&gulter.UploadedFileMetadata{}, nil).
+					Times(1)
+
+				return []gulter.FieldSpec{
+					{
+						Name:     "avatar",
+						MaxFiles: 1,
+						Storage:  avatarStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			useStreamingOpt:    true,
+		},
+		{
+			name: "upload fails because the field does not contain enough files",
+			files: []formFile{
+				{fieldName: "attachments", pathToFile: "gulter.md"},
+			},
+			fields: func(_, attachmentStore *mocks.MockStorage) []gulter.FieldSpec {
+				attachmentStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+
+				return []gulter.FieldSpec{
+					{
+						Name:     "attachments",
+						MinFiles: 2,
+						Storage:  attachmentStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "upload fails because the file is larger than the field allows",
+			files: []formFile{
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+			},
+			fields: func(avatarStore, _ *mocks.MockStorage) []gulter.FieldSpec {
+				avatarStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+
+				return []gulter.FieldSpec{
+					{
+						Name:        "avatar",
+						MaxFileSize: 1024,
+						Storage:     avatarStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "upload fails because the file is larger than the field allows when streaming",
+			files: []formFile{
+				{fieldName: "avatar", pathToFile: "image.jpg"},
+			},
+			fields: func(avatarStore, _ *mocks.MockStorage) []gulter.FieldSpec {
+				avatarStore.EXPECT().
+					Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, r io.Reader, _ *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+						_, err := io.Copy(io.Discard, r)
+						return nil, err
+					}).
+					Times(1)
+
+				return []gulter.FieldSpec{
+					{
+						Name:        "avatar",
+						MaxFileSize: 1024,
+						Storage:     avatarStore,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+			useStreamingOpt:    true,
+		},
+		{
+			name:  "upload fails because a required field does not exist",
+			files: []formFile{},
+			fields: func(avatarStore, _ *mocks.MockStorage) []gulter.FieldSpec {
+				return []gulter.FieldSpec{
+					{
+						Name:     "avatar",
+						Storage:  avatarStore,
+						Required: true,
+					},
+				}
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			avatarStore := mocks.NewMockStorage(ctrl)
+			attachmentStore := mocks.NewMockStorage(ctrl)
+
+			handler, err := gulter.New(
+				gulter.WithMaxFileSize(1024*1024),
+				gulter.WithStorage(mocks.NewMockStorage(ctrl)),
+				gulter.WithStreamingUploads(v.useStreamingOpt),
+			)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			handler.UploadFields(v.fields(avatarStore, attachmentStore)...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprintf(w, "successfully uploaded the file")
+			})).ServeHTTP(recorder, newMultipartRequest(t, v.files...))
+
+			require.Equal(t, v.expectedStatusCode, recorder.Result().StatusCode)
+			verifyMatch(t, recorder)
+		})
+	}
+}
+
+func TestGulter_Limits(t *testing.T) {
+	tt := []struct {
+		name               string
+		opts               []gulter.Option
+		files              []formFile
+		uploads            int
+		expectedStatusCode int
+	}{
+		{
+			name: "file size is known before it is uploaded",
+			opts: []gulter.Option{
+				gulter.WithValidationFunc(func(f gulter.File) error {
+					if f.Size != 51 {
+						return fmt.Errorf("unexpected file size (%d)", f.Size)
+					}
+
+					return nil
+				}),
+			},
+			files: []formFile{
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+			},
+			uploads:            1,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name: "upload fails because the file is larger than the file limit",
+			opts: []gulter.Option{
+				gulter.WithMaxFileSize(1024),
+				gulter.WithMaxRequestSize(1024 * 1024),
+			},
+			files: []formFile{
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "form-field", pathToFile: "image.jpg"},
+			},
+			uploads:            1,
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "upload fails because the field contains too many files",
+			opts: []gulter.Option{
+				gulter.WithMaxFilesPerField(1),
+			},
+			files: []formFile{
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "upload fails because the request contains too many files",
+			opts: []gulter.Option{
+				gulter.WithMaxFilesPerRequest(2),
+			},
+			files: []formFile{
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "other-form-field", pathToFile: "gulter.md"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "upload fails because the request contains too many files when streaming",
+			opts: []gulter.Option{
+				gulter.WithMaxFilesPerRequest(2),
+				gulter.WithStreamingUploads(true),
+			},
+			files: []formFile{
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "form-field", pathToFile: "gulter.md"},
+				{fieldName: "other-form-field", pathToFile: "gulter.md"},
+			},
+			uploads:            2,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorage(ctrl)
+
+			storage.EXPECT().
+				Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, r io.Reader, _ *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+					_, err := io.Copy(io.Discard, r)
+					return &gulter.UploadedFileMetadata{}, err
+				}).
+				Times(v.uploads)
+
+			handler, err := gulter.New(append([]gulter.Option{
+				gulter.WithStorage(storage),
+				gulter.WithIgnoreNonExistentKey(true),
+			}, v.opts...)...)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			handler.Upload("form-field", "other-form-field")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				files, err := gulter.FilesFromContextWithKey(r, "form-field")
+				require.NoError(t, err)
+
+				// the size is still reported even though the storage did not
+				require.Equal(t, int64(51), files[0].Size)
+
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprintf(w, "successfully uploaded the file")
+			})).ServeHTTP(recorder, newMultipartRequest(t, v.files...))
+
+			require.Equal(t, v.expectedStatusCode, recorder.Result().StatusCode)
+			verifyMatch(t, recorder)
+		})
+	}
+}
+
+func TestGulter_Validator(t *testing.T) {
+	expected, err := os.ReadFile(filepath.Join("testdata", "gulter.md"))
+	require.NoError(t, err)
+
+	validator := gulter.ValidatorFunc(func(ctx context.Context, input *gulter.ValidationInput) error {
+		if input.Request.Header.Get("X-User") != "lanre" {
+			return errors.New("only lanre can upload files")
+		}
+
+		b, err := io.ReadAll(input.Content)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(expected, b) {
+			return errors.New("unexpected file content")
+		}
+
+		return nil
+	})
+
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streaming=%v", streaming), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorage(ctrl)
+
+			storage.EXPECT().
+				Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, r io.Reader, _ *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+					b, err := io.ReadAll(r)
+					require.NoError(t, err)
+
+					// validators reading the file must not affect the upload
+					require.Equal(t, expected, b)
+
+					return &gulter.UploadedFileMetadata{}, nil
+				}).
+				Times(1)
+
+			handler, err := gulter.New(
+				gulter.WithStorage(storage),
+				gulter.WithStreamingUploads(streaming),
+				gulter.WithValidator(gulter.AllOf(
+					gulter.MimeTypeValidator("text/plain"),
+					validator,
+				)),
+			)
+			require.NoError(t, err)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			recorder := httptest.NewRecorder()
+
+			r := newMultipartRequest(t, formFile{fieldName: "form-field", pathToFile: "gulter.md"})
+			handler.Upload("form-field")(next).ServeHTTP(recorder, r)
+
+			require.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+
+			recorder = httptest.NewRecorder()
+
+			r = newMultipartRequest(t, formFile{fieldName: "form-field", pathToFile: "gulter.md"})
+			r.Header.Set("X-User", "lanre")
+			handler.Upload("form-field")(next).ServeHTTP(recorder, r)
+
+			require.Equal(t, http.StatusAccepted, recorder.Result().StatusCode)
+		})
+	}
+}
+
+func TestGulter_MimeDetector(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, r io.Reader, opts *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+			require.Equal(t, "image/x-gulter", opts.ContentType)
+
+			// the detector reading the file must not affect the upload
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NotEmpty(t, b)
+
+			return &gulter.UploadedFileMetadata{}, nil
+		}).
+		Times(1)
+
+	handler, err := gulter.New(
+		gulter.WithStorage(storage),
+		gulter.WithMimeDetector(gulter.MimeDetectorFunc(func(content io.ReadSeeker) (string, error) {
+			_, err := io.ReadAll(content)
+			return "image/x-gulter", err
+		})),
+		gulter.WithValidationFunc(gulter.MimeTypeValidator("image/x-gulter")),
+	)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	r := newMultipartRequest(t, formFile{fieldName: "form-field", pathToFile: "image.jpg"})
+
+	handler.Upload("form-field")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})).ServeHTTP(recorder, r)
+
+	require.Equal(t, http.StatusAccepted, recorder.Result().StatusCode)
+}
+
+func TestGulter_ContentTypeCheck(t *testing.T) {
+	pdf := []byte("%PDF-1.7\n")
+	html := []byte("<html><body><script>alert(1)</script></body></html>")
+
+	tt := []struct {
+		name               string
+		check              gulter.ContentTypeCheck
+		fileName           string
+		declaredType       string
+		content            []byte
+		expectedStatusCode int
+	}{
+		{
+			name:               "matching file",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/pdf",
+			content:            pdf,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "html uploaded as a pdf",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/pdf",
+			content:            html,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "html uploaded as a pdf without any check",
+			check:              gulter.ContentTypeCheckOff,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/pdf",
+			content:            html,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "declared type contradicts the content",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "invoice",
+			declaredType:       "application/pdf",
+			content:            html,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "unknown extension and generic type when lenient",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "invoice.gulter",
+			declaredType:       "application/octet-stream",
+			content:            pdf,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "content that cannot be identified when lenient",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "photo.heic",
+			declaredType:       "image/heic",
+			content:            []byte("\x00\x00\x00\x18ftypgult\x00\x00\x00\x00gultmif1"),
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "content that cannot be identified when strict",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "photo.heic",
+			declaredType:       "image/heic",
+			content:            []byte("\x00\x00\x00\x18ftypgult\x00\x00\x00\x00gultmif1"),
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "zip declared by a windows browser",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "archive.zip",
+			declaredType:       "application/x-zip-compressed",
+			content:            []byte("PK\x03\x04gulter"),
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "jpeg declared as image/jpg",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "photo.jpg",
+			declaredType:       "image/jpg",
+			content:            []byte("\xff\xd8\xff\xe0gulter"),
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "unknown declared type when lenient",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/vnd.gulter.invoice",
+			content:            pdf,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "unknown declared type when strict",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/vnd.gulter.invoice",
+			content:            pdf,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "known alias that contradicts the content",
+			check:              gulter.ContentTypeCheckLenient,
+			fileName:           "invoice",
+			declaredType:       "image/jpg",
+			content:            pdf,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "unknown extension when strict",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "invoice.gulter",
+			declaredType:       "application/pdf",
+			content:            pdf,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "generic type when strict",
+			check:              gulter.ContentTypeCheckStrict,
+			fileName:           "invoice.pdf",
+			declaredType:       "application/octet-stream",
+			content:            pdf,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorage(ctrl)
+
+			times := 0
+			if v.expectedStatusCode == http.StatusAccepted {
+				times = 1
+			}
+
+			storage.EXPECT().
+				Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(&gulter.UploadedFileMetadata{}, nil).
+				Times(times)
+
+			handler, err := gulter.New(
+				gulter.WithStorage(storage),
+				gulter.WithContentTypeCheck(v.check),
+			)
+			require.NoError(t, err)
+
+			buffer := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(buffer)
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition",
+				fmt.Sprintf(`form-data; name="form-field"; filename="%s"`, v.fileName))
+			header.Set("Content-Type", v.declaredType)
+
+			part, err := multipartWriter.CreatePart(header)
+			require.NoError(t, err)
+
+			_, err = part.Write(v.content)
+			require.NoError(t, err)
+
+			require.NoError(t, multipartWriter.Close())
+
+			r := httptest.NewRequest(http.MethodPost, "/", buffer)
+			r.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+			recorder := httptest.NewRecorder()
+
+			handler.Upload("form-field")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			})).ServeHTTP(recorder, r)
+
+			require.Equal(t, v.expectedStatusCode, recorder.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package gulter
+
+import "sync"
+
+// uploadLocks makes sure an upload is not updated by multiple requests at
+// once. A lock is forgotten once the last request that needs it releases
+// it, so requests for the same upload always share the same lock.
+// The zero value is ready to use
+type uploadLocks struct {
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is shared by the requests for the same upload. refs counts the
+// requests that hold or wait for it
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until no other request holds the lock of the upload and
+// returns the func that releases it
+func (l *uploadLocks) lock(id string) func() {
+	l.mu.Lock()
+
+	if l.locks == nil {
+		l.locks = make(map[string]*uploadLock)
+	}
+
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &uploadLock{}
+		l.locks[id] = lock
+	}
+
+	lock.refs++
+
+	l.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, id)
+		}
+	}
+}
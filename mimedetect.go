@@ -0,0 +1,411 @@
+package gulter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// MimeDetector detects the mimetype of a file from its content.
+// Implementations can read as much of the content as they need, gulter seeks
+// back to the start of the file afterwards
+type MimeDetector interface {
+	Detect(content io.ReadSeeker) (string, error)
+}
+
+// MimeDetectorFunc allows a function to be used as a MimeDetector
+type MimeDetectorFunc func(content io.ReadSeeker) (string, error)
+
+func (f MimeDetectorFunc) Detect(content io.ReadSeeker) (string, error) {
+	return f(content)
+}
+
+// defaultMimeDetector relies on http.DetectContentType
+var defaultMimeDetector MimeDetector = MimeDetectorFunc(fetchContentType)
+
+// sniffLen is the amount of bytes read from the start of a file when
+// matching signatures
+const sniffLen = 3072
+
+type signature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+func (s signature) match(b []byte) bool {
+	return len(b) >= s.offset+len(s.magic) && bytes.Equal(b[s.offset:s.offset+len(s.magic)], s.magic)
+}
+
+// signatures is the database of magic numbers used by the signature
+// detector. Formats that share their container, like zip, ftyp, RIFF,
+// Ogg and Matroska, are looked into further once matched
+var signatures = []signature{
+	// images
+	{0, []byte("\xFF\xD8\xFF"), "image/jpeg"},
+	{0, []byte("\x89PNG\r\n\x1A\n"), "image/png"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("\xFF\x0A"), "image/jxl"},
+	{0, []byte("\x00\x00\x00\x0CJXL \x0D\x0A\x87\x0A"), "image/jxl"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{0, []byte("\x00\x00\x01\x00"), "image/x-icon"},
+	{0, []byte("BM"), "image/bmp"},
+
+	// documents
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("{\\rtf"), "application/rtf"},
+	{0, []byte("%!PS"), "application/postscript"},
+	{0, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "application/x-ole-storage"},
+
+	// audio
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("MThd"), "audio/midi"},
+	{0, []byte("#!AMR"), "audio/amr"},
+	{0, []byte("\xFF\xF1"), "audio/aac"},
+	{0, []byte("\xFF\xF9"), "audio/aac"},
+	{0, []byte("\xFF\xFB"), "audio/mpeg"},
+	{0, []byte("\xFF\xF3"), "audio/mpeg"},
+	{0, []byte("\xFF\xF2"), "audio/mpeg"},
+
+	// video
+	{0, []byte("FLV\x01"), "video/x-flv"},
+	{0, []byte("\x00\x00\x01\xBA"), "video/mpeg"},
+	{0, []byte("\x00\x00\x01\xB3"), "video/mpeg"},
+
+	// archives
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("Rar!\x1A\x07"), "application/vnd.rar"},
+	{0, []byte("\x1F\x8B"), "application/gzip"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xB5\x2F\xFD"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+
+	// fonts
+	{0, []byte("wOFF"), "font/woff"},
+	{0, []byte("wOF2"), "font/woff2"},
+	{0, []byte("OTTO"), "font/otf"},
+	{0, []byte("\x00\x01\x00\x00\x00"), "font/ttf"},
+
+	// others
+	{0, []byte("\x7FELF"), "application/x-elf"},
+	{0, []byte("\x00asm"), "application/wasm"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+}
+
+// ftypBrands maps the major brand of ISO base media files to their mimetype
+var ftypBrands = map[string]string{
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"hevc": "image/heic-sequence",
+	"hevx": "image/heic-sequence",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif-sequence",
+	"crx ": "image/x-canon-cr3",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"M4V ": "video/x-m4v",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+	"3g2a": "video/3gpp2",
+}
+
+// zipPrefixes maps the entries found in zip based formats to their mimetype
+var zipPrefixes = []struct {
+	prefix   string
+	mimeType string
+}{
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{"META-INF/MANIFEST.MF", "application/java-archive"},
+	{"AndroidManifest.xml", "application/vnd.android.package-archive"},
+}
+
+type signatureMimeDetector struct{}
+
+// NewSignatureMimeDetector returns a MimeDetector that recognizes modern
+// document, image, audio, video, font and archive formats from their magic
+// numbers. Zip files are looked into to tell OOXML, ODF, EPUB, JAR and APK
+// files apart. Anything it does not recognize is detected with
+// http.DetectContentType
+func NewSignatureMimeDetector() MimeDetector {
+	return signatureMimeDetector{}
+}
+
+func (signatureMimeDetector) Detect(content io.ReadSeeker) (string, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(content, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	b = b[:n]
+
+	if mimeType := detectContainer(content, b); mimeType != "" {
+		return mimeType, nil
+	}
+
+	for _, sig := range signatures {
+		if sig.match(b) {
+			return sig.mimeType, nil
+		}
+	}
+
+	if isSVG(b) {
+		return "image/svg+xml", nil
+	}
+
+	return fetchContentType(content)
+}
+
+// detectContainer identifies formats that share the same container
+func detectContainer(content io.ReadSeeker, b []byte) string {
+	switch {
+	case len(b) >= 12 && bytes.Equal(b[4:8], []byte("ftyp")):
+		if mimeType, ok := ftypBrands[string(b[8:12])]; ok {
+			return mimeType
+		}
+
+		return "video/mp4"
+
+	case len(b) >= 12 && bytes.Equal(b[:4], []byte("RIFF")):
+		switch string(b[8:12]) {
+		case "WEBP":
+			return "image/webp"
+		case "WAVE":
+			return "audio/wav"
+		case "AVI ":
+			return "video/x-msvideo"
+		}
+
+	case len(b) >= 12 && bytes.Equal(b[:4], []byte("FORM")):
+		switch string(b[8:12]) {
+		case "AIFF", "AIFC":
+			return "audio/aiff"
+		}
+
+	case bytes.HasPrefix(b, []byte("OggS")):
+		switch {
+		case bytes.Contains(b, []byte("OpusHead")):
+			return "audio/opus"
+		case bytes.Contains(b, []byte("\x01vorbis")):
+			return "audio/ogg"
+		case bytes.Contains(b, []byte("\x80theora")):
+			return "video/ogg"
+		case bytes.Contains(b, []byte("\x7FFLAC")):
+			return "audio/ogg"
+		}
+
+		return "application/ogg"
+
+	case bytes.HasPrefix(b, []byte("\x1A\x45\xDF\xA3")):
+		// the DocType element of the EBML header
+		if bytes.Contains(b, []byte("\x42\x82\x84webm")) {
+			return "video/webm"
+		}
+
+		return "video/x-matroska"
+
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		return detectZip(content, b)
+	}
+
+	return ""
+}
+
+// detectZip looks at the entries of a zip file to find out which format
+// is stored in it. The central directory at the end of the file is used if
+// possible, else the local file headers at the start of the content are
+// read. This is the case when streaming uploads and only the first bytes of
+// the file are available
+func detectZip(content io.ReadSeeker, b []byte) string {
+	var names []string
+
+	if size, err := content.Seek(0, io.SeekEnd); err == nil {
+		if readerAt, ok := content.(io.ReaderAt); ok {
+			if r, err := zip.NewReader(readerAt, size); err == nil {
+				for _, f := range r.File {
+					// ODF and EPUB files store their mimetype uncompressed
+					// as the first entry
+					if f.Name == "mimetype" {
+						if mimeType := zipMimetypeEntry(f); mimeType != "" {
+							return mimeType
+						}
+					}
+
+					names = append(names, f.Name)
+				}
+			}
+		}
+	}
+
+	if names == nil {
+		var mimeType string
+
+		names, mimeType = zipLocalEntries(b)
+		if mimeType != "" {
+			return mimeType
+		}
+	}
+
+	for _, name := range names {
+		for _, p := range zipPrefixes {
+			if strings.HasPrefix(name, p.prefix) {
+				return p.mimeType
+			}
+		}
+	}
+
+	return "application/zip"
+}
+
+func zipMimetypeEntry(f *zip.File) string {
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+
+	defer rc.Close()
+
+	b, err := io.ReadAll(io.LimitReader(rc, 100))
+	if err != nil {
+		return ""
+	}
+
+	return validZipMimetype(string(b))
+}
+
+// zipLocalEntries walks the local file headers in b. It stops once an
+// entry's size is not known upfront or b has been exhausted
+func zipLocalEntries(b []byte) ([]string, string) {
+	const headerLen = 30
+
+	var names []string
+
+	for len(b) >= headerLen && bytes.HasPrefix(b, []byte("PK\x03\x04")) {
+		flags := binary.LittleEndian.Uint16(b[6:8])
+		method := binary.LittleEndian.Uint16(b[8:10])
+		compressedSize := int(binary.LittleEndian.Uint32(b[18:22]))
+		nameLen := int(binary.LittleEndian.Uint16(b[26:28]))
+		extraLen := int(binary.LittleEndian.Uint16(b[28:30]))
+
+		if len(b) < headerLen+nameLen {
+			break
+		}
+
+		name := string(b[headerLen : headerLen+nameLen])
+		names = append(names, name)
+
+		dataStart := headerLen + nameLen + extraLen
+
+		if name == "mimetype" && method == zip.Store && len(b) >= dataStart {
+			size := compressedSize
+
+			// the data of a stored entry ends where the next record starts
+			if flags&0x8 != 0 {
+				size = bytes.Index(b[dataStart:], []byte("PK"))
+			}
+
+			if size >= 0 && len(b) >= dataStart+size {
+				if mimeType := validZipMimetype(string(b[dataStart : dataStart+size])); mimeType != "" {
+					return names, mimeType
+				}
+			}
+		}
+
+		// the sizes are stored after the data
+		if flags&0x8 != 0 {
+			break
+		}
+
+		if len(b) < dataStart+compressedSize {
+			break
+		}
+
+		b = b[dataStart+compressedSize:]
+	}
+
+	return names, ""
+}
+
+// validZipMimetype only trusts the mimetype entry of the formats that use
+// this convention. Any zip can contain one, so it cannot be used to pass
+// a zip off as a PDF for example
+func validZipMimetype(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, " \r\n") {
+		return ""
+	}
+
+	if s == "application/epub+zip" || strings.HasPrefix(s, "application/vnd.oasis.opendocument.") {
+		return s
+	}
+
+	return ""
+}
+
+// isSVG reports if b looks like an SVG document. XML declarations, comments
+// and doctypes before the root element are skipped
+func isSVG(b []byte) bool {
+	b = bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF"))
+	b = bytes.TrimSpace(b)
+
+	if !bytes.HasPrefix(b, []byte("<")) {
+		return false
+	}
+
+	for len(b) > 0 {
+		b = bytes.TrimSpace(b)
+
+		switch {
+		case bytes.HasPrefix(b, []byte("<?")):
+			_, rest, ok := bytes.Cut(b, []byte("?>"))
+			if !ok {
+				return false
+			}
+
+			b = rest
+
+		case bytes.HasPrefix(b, []byte("<!--")):
+			_, rest, ok := bytes.Cut(b, []byte("-->"))
+			if !ok {
+				return false
+			}
+
+			b = rest
+
+		case bytes.HasPrefix(b, []byte("<!")):
+			_, rest, ok := bytes.Cut(b, []byte(">"))
+			if !ok {
+				return false
+			}
+
+			b = rest
+
+		default:
+			return bytes.HasPrefix(b, []byte("<svg")) &&
+				len(b) > 4 && strings.ContainsRune(" \t\r\n>/", rune(b[4]))
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package gulter_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func zipFile(t *testing.T, mimetype string, names ...string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	w := zip.NewWriter(&b)
+
+	if mimetype != "" {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte(mimetype))
+		require.NoError(t, err)
+	}
+
+	for _, name := range names {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+
+		_, err = f.Write(bytes.Repeat([]byte("gulter"), 100))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+
+	return b.Bytes()
+}
+
+func TestSignatureMimeDetector(t *testing.T) {
+	docx := zipFile(t, "", "word/document.xml", "[Content_Types].xml")
+	odt := zipFile(t, "application/vnd.oasis.opendocument.text", "content.xml")
+
+	tt := []struct {
+		name     string
+		content  []byte
+		mimeType string
+	}{
+		{
+			name:     "docx",
+			content:  docx,
+			mimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		},
+		{
+			name:     "docx when only the start of the file is available",
+			content:  docx[:100],
+			mimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		},
+		{
+			name:     "xlsx",
+			content:  zipFile(t, "", "[Content_Types].xml", "xl/workbook.xml"),
+			mimeType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		},
+		{
+			name:     "odt",
+			content:  odt,
+			mimeType: "application/vnd.oasis.opendocument.text",
+		},
+		{
+			name:     "odt when only the start of the file is available",
+			content:  odt[:100],
+			mimeType: "application/vnd.oasis.opendocument.text",
+		},
+		{
+			name:     "epub",
+			content:  zipFile(t, "application/epub+zip", "OEBPS/content.opf"),
+			mimeType: "application/epub+zip",
+		},
+		{
+			name:     "zip with a forged mimetype entry",
+			content:  zipFile(t, "application/pdf", "notes.txt"),
+			mimeType: "application/zip",
+		},
+		{
+			name:     "zip with a forged mimetype entry when only the start of the file is available",
+			content:  zipFile(t, "application/pdf", "notes.txt")[:100],
+			mimeType: "application/zip",
+		},
+		{
+			name:     "plain zip",
+			content:  zipFile(t, "", "notes.txt"),
+			mimeType: "application/zip",
+		},
+		{
+			name:     "heic",
+			content:  []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"),
+			mimeType: "image/heic",
+		},
+		{
+			name:     "avif",
+			content:  []byte("\x00\x00\x00\x1CftypavifA\x00\x00\x00avifmif1miaf"),
+			mimeType: "image/avif",
+		},
+		{
+			name:     "mp4",
+			content:  []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2"),
+			mimeType: "video/mp4",
+		},
+		{
+			name:     "webp",
+			content:  []byte("RIFF\x24\x00\x00\x00WEBPVP8X"),
+			mimeType: "image/webp",
+		},
+		{
+			name:     "mkv",
+			content:  []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x88matroska"),
+			mimeType: "video/x-matroska",
+		},
+		{
+			name:     "webm",
+			content:  []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"),
+			mimeType: "video/webm",
+		},
+		{
+			name:     "7z",
+			content:  []byte("7z\xBC\xAF\x27\x1C\x00\x04"),
+			mimeType: "application/x-7z-compressed",
+		},
+		{
+			name:     "opus",
+			content:  []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00OpusHead"),
+			mimeType: "audio/opus",
+		},
+		{
+			name:     "svg",
+			content:  []byte(`<?xml version="1.0"?><!-- logo --><svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+			mimeType: "image/svg+xml",
+		},
+		{
+			name:     "unknown formats fall back to http.DetectContentType",
+			content:  []byte("gulter"),
+			mimeType: "text/plain",
+		},
+	}
+
+	detector := gulter.NewSignatureMimeDetector()
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			mimeType, err := detector.Detect(bytes.NewReader(v.content))
+			require.NoError(t, err)
+			require.Equal(t, v.mimeType, mimeType)
+		})
+	}
+}
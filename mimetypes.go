@@ -0,0 +1,231 @@
+package gulter
+
+import (
+	"mime"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// extensionMimeTypes maps a file extension to the mimetypes its content
+// can be detected as. Some formats share their container with others, Office
+// documents are zip files as an example, so they are detected as such
+var extensionMimeTypes = map[string][]string{
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".tif":  {"image/tiff"},
+	".tiff": {"image/tiff"},
+	".heic": {"image/heic", "image/heif", "image/heic-sequence"},
+	".heif": {"image/heif", "image/heic", "image/heif-sequence"},
+	".jxl":  {"image/jxl"},
+	".psd":  {"image/vnd.adobe.photoshop"},
+	".ico":  {"image/x-icon", "image/vnd.microsoft.icon"},
+	".avif": {"image/avif"},
+	".svg":  {"image/svg+xml", "text/xml", "application/xml", "text/plain"},
+
+	".pdf": {"application/pdf"},
+	".zip": {"application/zip"},
+	".gz":  {"application/x-gzip", "application/gzip"},
+	".rar": {"application/x-rar-compressed", "application/vnd.rar"},
+	".7z":  {"application/x-7z-compressed"},
+	".bz2": {"application/x-bzip2"},
+	".xz":  {"application/x-xz"},
+	".zst": {"application/zstd"},
+	".tar": {"application/x-tar", "application/octet-stream"},
+
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "application/zip"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "application/zip"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", "application/zip"},
+	".odp":  {"application/vnd.oasis.opendocument.presentation", "application/zip"},
+	".epub": {"application/epub+zip", "application/zip"},
+	".jar":  {"application/java-archive", "application/zip"},
+	".apk":  {"application/vnd.android.package-archive", "application/zip"},
+	".doc":  {"application/x-ole-storage", "application/msword"},
+	".xls":  {"application/x-ole-storage", "application/vnd.ms-excel"},
+	".ppt":  {"application/x-ole-storage", "application/vnd.ms-powerpoint"},
+	".rtf":  {"application/rtf", "text/rtf", "text/plain"},
+
+	".txt":  {"text/plain"},
+	".md":   {"text/plain", "text/markdown"},
+	".csv":  {"text/plain", "text/csv"},
+	".json": {"text/plain", "application/json"},
+	".html": {"text/html"},
+	".js":   {"text/plain", "text/javascript", "application/javascript"},
+	".mjs":  {"text/plain", "text/javascript", "application/javascript"},
+	".css":  {"text/plain", "text/css"},
+	".htm":  {"text/html"},
+	".xml":  {"text/xml", "application/xml"},
+
+	".mp3":  {"audio/mpeg"},
+	".wav":  {"audio/wave", "audio/wav", "audio/x-wav"},
+	".ogg":  {"application/ogg", "audio/ogg", "video/ogg", "audio/opus"},
+	".flac": {"audio/flac", "audio/x-flac"},
+	".opus": {"audio/opus", "application/ogg"},
+	".m4a":  {"audio/mp4", "video/mp4"},
+	".aac":  {"audio/aac"},
+	".aiff": {"audio/aiff"},
+	".mid":  {"audio/midi"},
+	".midi": {"audio/midi"},
+	".amr":  {"audio/amr"},
+	".mp4":  {"video/mp4"},
+	".webm": {"video/webm"},
+	".mkv":  {"video/x-matroska", "video/webm"},
+	".mov":  {"video/quicktime", "video/mp4"},
+	".m4v":  {"video/x-m4v", "video/mp4"},
+	".3gp":  {"video/3gpp", "video/mp4"},
+	".flv":  {"video/x-flv"},
+	".mpg":  {"video/mpeg"},
+	".mpeg": {"video/mpeg"},
+
+	".woff":  {"font/woff"},
+	".woff2": {"font/woff2"},
+	".ttf":   {"font/ttf"},
+	".otf":   {"font/otf"},
+	".wasm":  {"application/wasm"},
+	".exe":   {"application/vnd.microsoft.portable-executable", "application/octet-stream"},
+	".avi":   {"video/avi", "video/x-msvideo"},
+}
+
+// mimeTypeAliases maps the non standard mimetypes some clients declare to
+// the mimetype the content is detected as. Browsers on Windows declare zip
+// files as application/x-zip-compressed as an example
+var mimeTypeAliases = map[string]string{
+	"image/jpg":                    "image/jpeg",
+	"image/pjpeg":                  "image/jpeg",
+	"image/x-png":                  "image/png",
+	"application/x-zip-compressed": "application/zip",
+	"application/x-pdf":            "application/pdf",
+	"audio/mp3":                    "audio/mpeg",
+	"audio/x-mp3":                  "audio/mpeg",
+}
+
+// fileExtension returns the lowercased extension of a file name including
+// the leading dot
+func fileExtension(name string) string {
+	return strings.ToLower(filepath.Ext(name))
+}
+
+// baseMimeType strips the parameters, like the charset, from a mimetype
+func baseMimeType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(mimeType))
+	}
+
+	return mediaType
+}
+
+// ContentTypeCheck configures how the extension and the Content-Type
+// declared by the client are compared with the mimetype detected from the
+// content of a file
+type ContentTypeCheck int
+
+const (
+	// ContentTypeCheckOff does not compare them at all
+	ContentTypeCheckOff ContentTypeCheck = iota
+
+	// ContentTypeCheckLenient rejects files whose extension or declared
+	// Content-Type is known to contradict the detected mimetype. Extensions
+	// and types gulter does not know about, generic types like
+	// application/octet-stream and content the detector cannot identify
+	// are accepted. Common aliases like image/jpg are understood
+	ContentTypeCheckLenient
+
+	// ContentTypeCheckStrict rejects files unless their extension is known
+	// and both the extension and the declared Content-Type match the
+	// detected mimetype
+	ContentTypeCheckStrict
+)
+
+// check makes sure the extension of fileName and the declared type do not
+// contradict the detected mimetype
+func (c ContentTypeCheck) check(fileName, declared, detected string) error {
+	if c == ContentTypeCheckOff {
+		return nil
+	}
+
+	ext := fileExtension(fileName)
+	detectedType := baseMimeType(detected)
+
+	// the detector could not identify the content, so there is nothing to
+	// compare the extension and declared type with
+	if detectedType == "application/octet-stream" && c == ContentTypeCheckLenient {
+		return nil
+	}
+
+	mismatch := &ContentTypeMismatchError{
+		Extension:    ext,
+		DeclaredType: declared,
+		DetectedType: detected,
+	}
+
+	mimeTypes, ok := extensionMimeTypes[ext]
+	if !ok && c == ContentTypeCheckStrict {
+		return mismatch
+	}
+
+	if ok && !slices.Contains(mimeTypes, detectedType) {
+		return mismatch
+	}
+
+	var declaredType string
+	if declared != "" {
+		declaredType = baseMimeType(declared)
+	}
+
+	if alias, ok := mimeTypeAliases[declaredType]; ok {
+		declaredType = alias
+	}
+
+	switch {
+	case declaredType == detectedType:
+		return nil
+
+	case declaredType == "" || declaredType == "application/octet-stream":
+		if c == ContentTypeCheckStrict {
+			return mismatch
+		}
+
+		return nil
+
+	// there is nothing to compare a type gulter does not know about with
+	case c == ContentTypeCheckLenient && !knownMimeType(declaredType):
+		return nil
+
+	case !compatibleMimeTypes(declaredType, detectedType):
+		return mismatch
+	}
+
+	return nil
+}
+
+// knownMimeType reports if the content of a file can be detected as
+// mimeType
+func knownMimeType(mimeType string) bool {
+	for _, mimeTypes := range extensionMimeTypes {
+		if slices.Contains(mimeTypes, mimeType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compatibleMimeTypes reports if both mimetypes can describe the same file.
+// An OOXML document is detected as a zip file by http.DetectContentType as
+// an example
+func compatibleMimeTypes(a, b string) bool {
+	for _, mimeTypes := range extensionMimeTypes {
+		if slices.Contains(mimeTypes, a) && slices.Contains(mimeTypes, b) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -56,6 +56,51 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
+// Delete mocks base method.
+func (m *MockStorage) Delete(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockStorageMockRecorder) Delete(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorage)(nil).Delete), arg0, arg1)
+}
+
+// Exists mocks base method.
+func (m *MockStorage) Exists(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockStorageMockRecorder) Exists(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockStorage)(nil).Exists), arg0, arg1)
+}
+
+// Get mocks base method.
+func (m *MockStorage) Get(arg0 context.Context, arg1 string) (io.ReadCloser, *gulter.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(*gulter.FileInfo)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockStorageMockRecorder) Get(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorage)(nil).Get), arg0, arg1)
+}
+
 // Path mocks base method.
 func (m *MockStorage) Path(arg0 context.Context, arg1 gulter.PathOptions) (string, error) {
 	m.ctrl.T.Helper()
@@ -71,6 +116,21 @@ func (mr *MockStorageMockRecorder) Path(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Path", reflect.TypeOf((*MockStorage)(nil).Path), arg0, arg1)
 }
 
+// Stat mocks base method.
+func (m *MockStorage) Stat(arg0 context.Context, arg1 string) (*gulter.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0, arg1)
+	ret0, _ := ret[0].(*gulter.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockStorageMockRecorder) Stat(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockStorage)(nil).Stat), arg0, arg1)
+}
+
 // Upload mocks base method.
 func (m *MockStorage) Upload(arg0 context.Context, arg1 io.Reader, arg2 *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
 	m.ctrl.T.Helper()
@@ -85,3 +145,139 @@ func (mr *MockStorageMockRecorder) Upload(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockStorage)(nil).Upload), arg0, arg1, arg2)
 }
+
+// MockRangeStorage is a mock of RangeStorage interface.
+type MockRangeStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockRangeStorageMockRecorder
+	isgomock struct{}
+}
+
+// MockRangeStorageMockRecorder is the mock recorder for MockRangeStorage.
+type MockRangeStorageMockRecorder struct {
+	mock *MockRangeStorage
+}
+
+// NewMockRangeStorage creates a new mock instance.
+func NewMockRangeStorage(ctrl *gomock.Controller) *MockRangeStorage {
+	mock := &MockRangeStorage{ctrl: ctrl}
+	mock.recorder = &MockRangeStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRangeStorage) EXPECT() *MockRangeStorageMockRecorder {
+	return m.recorder
+}
+
+// GetRange mocks base method.
+func (m *MockRangeStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRange", ctx, key, offset, length)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRange indicates an expected call of GetRange.
+func (mr *MockRangeStorageMockRecorder) GetRange(ctx, key, offset, length any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRange", reflect.TypeOf((*MockRangeStorage)(nil).GetRange), ctx, key, offset, length)
+}
+
+// MockMultipartStorage is a mock of MultipartStorage interface.
+type MockMultipartStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockMultipartStorageMockRecorder
+	isgomock struct{}
+}
+
+// MockMultipartStorageMockRecorder is the mock recorder for MockMultipartStorage.
+type MockMultipartStorageMockRecorder struct {
+	mock *MockMultipartStorage
+}
+
+// NewMockMultipartStorage creates a new mock instance.
+func NewMockMultipartStorage(ctrl *gomock.Controller) *MockMultipartStorage {
+	mock := &MockMultipartStorage{ctrl: ctrl}
+	mock.recorder = &MockMultipartStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMultipartStorage) EXPECT() *MockMultipartStorageMockRecorder {
+	return m.recorder
+}
+
+// AbortMultipartUpload mocks base method.
+func (m *MockMultipartStorage) AbortMultipartUpload(arg0 context.Context, arg1 *gulter.MultipartUpload) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AbortMultipartUpload indicates an expected call of AbortMultipartUpload.
+func (mr *MockMultipartStorageMockRecorder) AbortMultipartUpload(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortMultipartUpload", reflect.TypeOf((*MockMultipartStorage)(nil).AbortMultipartUpload), arg0, arg1)
+}
+
+// CompleteMultipartUpload mocks base method.
+func (m *MockMultipartStorage) CompleteMultipartUpload(arg0 context.Context, arg1 *gulter.MultipartUpload, arg2 []gulter.MultipartPart) (*gulter.UploadedFileMetadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteMultipartUpload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*gulter.UploadedFileMetadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteMultipartUpload indicates an expected call of CompleteMultipartUpload.
+func (mr *MockMultipartStorageMockRecorder) CompleteMultipartUpload(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteMultipartUpload", reflect.TypeOf((*MockMultipartStorage)(nil).CompleteMultipartUpload), arg0, arg1, arg2)
+}
+
+// CreateMultipartUpload mocks base method.
+func (m *MockMultipartStorage) CreateMultipartUpload(arg0 context.Context, arg1 *gulter.UploadFileOptions) (*gulter.MultipartUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(*gulter.MultipartUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMultipartUpload indicates an expected call of CreateMultipartUpload.
+func (mr *MockMultipartStorageMockRecorder) CreateMultipartUpload(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMultipartUpload", reflect.TypeOf((*MockMultipartStorage)(nil).CreateMultipartUpload), arg0, arg1)
+}
+
+// MinPartSize mocks base method.
+func (m *MockMultipartStorage) MinPartSize() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MinPartSize")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// MinPartSize indicates an expected call of MinPartSize.
+func (mr *MockMultipartStorageMockRecorder) MinPartSize() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MinPartSize", reflect.TypeOf((*MockMultipartStorage)(nil).MinPartSize))
+}
+
+// UploadPart mocks base method.
+func (m *MockMultipartStorage) UploadPart(ctx context.Context, upload *gulter.MultipartUpload, partNumber int, r io.ReadSeeker, size int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadPart", ctx, upload, partNumber, r, size)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UploadPart indicates an expected call of UploadPart.
+func (mr *MockMultipartStorageMockRecorder) UploadPart(ctx, upload, partNumber, r, size any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadPart", reflect.TypeOf((*MockMultipartStorage)(nil).UploadPart), ctx, upload, partNumber, r, size)
+}
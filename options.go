@@ -1,7 +1,7 @@
 package gulter
 
 import (
-	"fmt"
+	"context"
 	"strings"
 )
 
@@ -14,11 +14,15 @@ func MimeTypeValidator(validMimeTypes ...string) ValidationFunc {
 				return nil
 			}
 		}
-		return fmt.Errorf("unsupported mime type uploaded..(%s)", f.MimeType)
+		return &MimeTypeError{
+			MimeType: f.MimeType,
+			Allowed:  validMimeTypes,
+		}
 	}
 }
 
-// ChainValidators returns a validator that accepts multiple validating criteriacriteria
+// ChainValidators returns a validator that accepts multiple validating criteria.
+// Use AllOf if you need to combine a Validator
 func ChainValidators(validators ...ValidationFunc) ValidationFunc {
 	return func(f File) error {
 		for _, validator := range validators {
@@ -30,3 +34,21 @@ func ChainValidators(validators ...ValidationFunc) ValidationFunc {
 		return nil
 	}
 }
+
+// AllOf returns a Validator that only accepts a file if all the provided
+// validators accept it. Validators run in order and the first error is returned
+func AllOf(validators ...Validator) Validator {
+	return ValidatorFunc(func(ctx context.Context, input *ValidationInput) error {
+		for _, validator := range validators {
+			if err := validator.Validate(ctx, input); err != nil {
+				return err
+			}
+
+			if err := input.rewind(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
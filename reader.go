@@ -29,3 +29,22 @@ func ReaderToSeeker(r io.Reader) (io.ReadSeeker, error) {
 	// which you can now pass to the gulter uploader
 	return tmpfile, nil
 }
+
+// uploadReader keeps track of how many bytes have been read and the first
+// error that occurred while reading
+type uploadReader struct {
+	r    io.Reader
+	read int64
+	err  error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.read += int64(n)
+
+	if err != nil && err != io.EOF && u.err == nil {
+		u.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,88 @@
+package gulter
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength is the most amount of bytes most filesystems allow in a
+// file name
+const maxFilenameLength = 255
+
+// SanitizeFilename makes a file name sent by a client safe to use on any
+// filesystem. It keeps only the last element of the path, strips control and
+// invisible formatting characters like right-to-left overrides, replaces
+// characters that are not allowed on Windows or look like path separators,
+// trims leading dots and prevents reserved Windows names like CON or NUL.
+// The result is at most 255 bytes long and is never empty
+func SanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	var b strings.Builder
+
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError,
+			unicode.IsControl(r),
+			// zero width characters and bidi overrides
+			unicode.Is(unicode.Cf, r):
+			continue
+
+		case strings.ContainsRune(`<>:"|?*`, r),
+			// characters that render like a slash or backslash
+			strings.ContainsRune("⁄∕⧸⧹／＼", r):
+			b.WriteRune('_')
+
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name = strings.TrimLeft(b.String(), ". ")
+
+	// Windows silently drops trailing dots and spaces
+	name = strings.TrimRight(name, ". ")
+
+	if name == "" {
+		return "file"
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	for _, reserved := range reservedFilenames {
+		if strings.EqualFold(strings.TrimSpace(base), reserved) {
+			name = "_" + name
+			break
+		}
+	}
+
+	if len(name) > maxFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) >= maxFilenameLength {
+			ext = ""
+		}
+
+		name = truncateUTF8(strings.TrimSuffix(name, ext), maxFilenameLength-len(ext)) + ext
+	}
+
+	return name
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
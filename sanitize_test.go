@@ -0,0 +1,84 @@
+package gulter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tt := []struct {
+		name     string
+		fileName string
+		expected string
+	}{
+		{
+			name:     "safe file name",
+			fileName: "my notes.txt",
+			expected: "my notes.txt",
+		},
+		{
+			name:     "path traversal",
+			fileName: "../../etc/passwd",
+			expected: "passwd",
+		},
+		{
+			name:     "windows path",
+			fileName: `C:\Users\lanre\avatar.png`,
+			expected: "avatar.png",
+		},
+		{
+			name:     "hidden files",
+			fileName: "..htaccess",
+			expected: "htaccess",
+		},
+		{
+			name:     "control characters",
+			fileName: "notes\x00\n.txt",
+			expected: "notes.txt",
+		},
+		{
+			name:     "right to left override",
+			fileName: "invoice\u202egnp.exe",
+			expected: "invoicegnp.exe",
+		},
+		{
+			name:     "characters that look like slashes",
+			fileName: "a\u2215b\uff0fc.txt",
+			expected: "a_b_c.txt",
+		},
+		{
+			name:     "characters not allowed on windows",
+			fileName: `what?<is>"this".txt`,
+			expected: "what__is__this_.txt",
+		},
+		{
+			name:     "reserved windows names",
+			fileName: "con.txt",
+			expected: "_con.txt",
+		},
+		{
+			name:     "trailing dots and spaces",
+			fileName: "notes.txt. . ",
+			expected: "notes.txt",
+		},
+		{
+			name:     "nothing left",
+			fileName: "../..",
+			expected: "file",
+		},
+		{
+			name:     "long names keep their extension",
+			fileName: strings.Repeat("é", 200) + ".txt",
+			expected: strings.Repeat("é", 125) + ".txt",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			require.Equal(t, v.expected, gulter.SanitizeFilename(v.fileName))
+		})
+	}
+}
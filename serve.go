@@ -0,0 +1,218 @@
+package gulter
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRedirectExpiration is how long the URLs clients are redirected to
+// are valid for
+const defaultRedirectExpiration = 15 * time.Minute
+
+// Redirecter is implemented by storage backends whose files are better
+// downloaded from the backend directly. ServeFile redirects clients to the
+// URL returned by Path instead of streaming the file through your server
+type Redirecter interface {
+	RedirectDownloads() bool
+}
+
+// ServeOptions configures how ServeFile sends a file to the client
+type ServeOptions struct {
+	// Inline displays the file in the browser instead of downloading it
+	Inline bool
+
+	// FileName is the name the client saves the file as. Defaults to the
+	// original name of the file if the backend stores it, else the last
+	// element of the key
+	FileName string
+
+	// DisableRedirects streams files through your server even if the
+	// storage backend prefers redirects
+	DisableRedirects bool
+
+	// RedirectExpiration is how long the URL clients are redirected to is
+	// valid for. Defaults to 15 minutes
+	RedirectExpiration time.Duration
+
+	// ErrorResponseHandler writes the response if the file cannot be
+	// served. Defaults to a JSON body like failed uploads
+	ErrorResponseHandler ErrResponseHandler
+}
+
+func defaultServeErrorResponseHandler(err error) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, "application/json", ErrorStatusCode(err), ErrorResponse{
+			Message: "could not retrieve file",
+			Error:   err.Error(),
+			Code:    ErrorCode(err),
+		})
+	}
+}
+
+// DownloadHandler returns a http.Handler that serves the file stored with
+// the key returned by keyFunc. With the standard library router, it can be
+// used like this:
+//
+//	mux.Handle("GET /files/{key...}", gulter.DownloadHandler(store, func(r *http.Request) string {
+//		return r.PathValue("key")
+//	}, nil))
+func DownloadHandler(store Storage, keyFunc func(r *http.Request) string, opts *ServeOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeFile(w, r, store, keyFunc(r), opts)
+	})
+}
+
+// ServeFile sends the file stored with the given key to the client.
+// Range requests and conditional requests with If-None-Match and
+// If-Modified-Since are supported if the backend returns a seekable file,
+// like Disk. If the backend prefers redirects, like S3 and Cloudinary, the
+// client is redirected to the file instead
+func ServeFile(w http.ResponseWriter, r *http.Request, store Storage, key string, opts *ServeOptions) {
+	if opts == nil {
+		opts = &ServeOptions{}
+	}
+
+	ctx := r.Context()
+
+	if redirecter, ok := store.(Redirecter); ok && redirecter.RedirectDownloads() && !opts.DisableRedirects {
+		expiration := opts.RedirectExpiration
+		if expiration <= 0 {
+			expiration = defaultRedirectExpiration
+		}
+
+		u, err := store.Path(ctx, PathOptions{
+			Key:            key,
+			IsSecure:       true,
+			ExpirationTime: expiration,
+		})
+		if err != nil {
+			ServeError(w, r, err, opts)
+			return
+		}
+
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+
+	rc, info, err := store.Get(ctx, key)
+	if err != nil {
+		ServeError(w, r, err, opts)
+		return
+	}
+
+	defer rc.Close()
+
+	fileName := opts.FileName
+	if fileName == "" {
+		fileName = originalName(info)
+	}
+
+	disposition := "attachment"
+	if opts.Inline {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": fileName,
+	}))
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+
+	if seeker, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, fileName, info.LastModified, seeker)
+		return
+	}
+
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, info) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, rc)
+	}
+}
+
+// ServeError writes the same error response ServeFile does when a file
+// cannot be served
+func ServeError(w http.ResponseWriter, r *http.Request, err error, opts *ServeOptions) {
+	errorResponseHandler := defaultServeErrorResponseHandler
+	if opts != nil && opts.ErrorResponseHandler != nil {
+		errorResponseHandler = opts.ErrorResponseHandler
+	}
+
+	errorResponseHandler(err).ServeHTTP(w, r)
+}
+
+// originalName retrieves the name of the file as it was uploaded
+func originalName(info *FileInfo) string {
+	if name, ok := info.Metadata[MetadataOriginalName]; ok {
+		if unescaped, err := url.PathUnescape(name); err == nil && unescaped != "" {
+			return unescaped
+		}
+	}
+
+	return path.Base(info.Key)
+}
+
+// notModified evaluates the conditional headers of requests for files that
+// cannot be served with http.ServeContent
+func notModified(r *http.Request, info *FileInfo) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if info.ETag == "" {
+			return false
+		}
+
+		for _, etag := range strings.Split(inm, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == "*" || strings.TrimPrefix(etag, "W/") == strings.TrimPrefix(info.ETag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !info.LastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+
+		return !info.LastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
@@ -0,0 +1,191 @@
+package gulter_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/adelowo/gulter/mocks"
+	"github.com/adelowo/gulter/storage"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestServeFile(t *testing.T) {
+	disk, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	metadata, err := disk.Upload(context.Background(), strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+
+	info, err := disk.Stat(context.Background(), metadata.Key)
+	require.NoError(t, err)
+
+	handler := gulter.DownloadHandler(disk, func(r *http.Request) string {
+		return r.PathValue("key")
+	}, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /files/{key...}", handler)
+
+	tt := []struct {
+		name               string
+		path               string
+		headers            map[string]string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "entire file",
+			path:               "/files/gulter.txt",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "hello gulter",
+		},
+		{
+			name:               "byte range",
+			path:               "/files/gulter.txt",
+			headers:            map[string]string{"Range": "bytes=6-"},
+			expectedStatusCode: http.StatusPartialContent,
+			expectedBody:       "gulter",
+		},
+		{
+			name:               "etag matches",
+			path:               "/files/gulter.txt",
+			headers:            map[string]string{"If-None-Match": info.ETag},
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name: "not modified since",
+			path: "/files/gulter.txt",
+			headers: map[string]string{
+				"If-Modified-Since": info.LastModified.Add(time.Hour).UTC().Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:               "file does not exist",
+			path:               "/files/unknown.txt",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			for k, value := range v.headers {
+				r.Header.Set(k, value)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			mux.ServeHTTP(recorder, r)
+
+			require.Equal(t, v.expectedStatusCode, recorder.Code)
+
+			if v.expectedStatusCode == http.StatusNotFound {
+				require.Contains(t, recorder.Body.String(), gulter.ErrorCodeFileNotFound)
+				return
+			}
+
+			require.Equal(t, v.expectedBody, recorder.Body.String())
+			require.Equal(t, info.ETag, recorder.Header().Get("ETag"))
+			require.Equal(t, `attachment; filename=gulter.txt`, recorder.Header().Get("Content-Disposition"))
+		})
+	}
+}
+
+func TestServeFile_NotSeekable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStorage(ctrl)
+
+	store.EXPECT().
+		Get(gomock.Any(), "avatars/gulter").
+		DoAndReturn(func(_ context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+			return io.NopCloser(strings.NewReader("hello gulter")), &gulter.FileInfo{
+				Key:         key,
+				Size:        12,
+				ContentType: "text/plain",
+				ETag:        `"gulter"`,
+				Metadata: map[string]string{
+					gulter.MetadataOriginalName: "my%20notes.txt",
+				},
+			}, nil
+		}).
+		Times(2)
+
+	recorder := httptest.NewRecorder()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	gulter.ServeFile(recorder, r, store, "avatars/gulter", &gulter.ServeOptions{Inline: true})
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "hello gulter", recorder.Body.String())
+	require.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `inline; filename="my notes.txt"`, recorder.Header().Get("Content-Disposition"))
+
+	recorder = httptest.NewRecorder()
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", `W/"gulter"`)
+	gulter.ServeFile(recorder, r, store, "avatars/gulter", nil)
+
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+}
+
+type redirectingStorage struct {
+	*mocks.MockStorage
+}
+
+func (redirectingStorage) RedirectDownloads() bool { return true }
+
+func TestServeFile_Redirect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStorage(ctrl)
+
+	store.EXPECT().
+		Path(gomock.Any(), gulter.PathOptions{
+			Key:            "gulter.txt",
+			IsSecure:       true,
+			ExpirationTime: time.Minute,
+		}).
+		Return("https://cdn.example.com/gulter.txt?signature=gulter", nil).
+		Times(1)
+
+	store.EXPECT().
+		Get(gomock.Any(), "gulter.txt").
+		Return(io.NopCloser(strings.NewReader("hello gulter")), &gulter.FileInfo{Key: "gulter.txt"}, nil).
+		Times(1)
+
+	recorder := httptest.NewRecorder()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	gulter.ServeFile(recorder, r, redirectingStorage{store}, "gulter.txt", &gulter.ServeOptions{
+		RedirectExpiration: time.Minute,
+	})
+
+	require.Equal(t, http.StatusFound, recorder.Code)
+	require.Equal(t, "https://cdn.example.com/gulter.txt?signature=gulter", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+
+	gulter.ServeFile(recorder, r, redirectingStorage{store}, "gulter.txt", &gulter.ServeOptions{
+		DisableRedirects: true,
+	})
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "hello gulter", recorder.Body.String())
+}
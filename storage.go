@@ -6,9 +6,24 @@ import (
 	"time"
 )
 
+const (
+	ErrFileNotFound = errorMsg("gulter: file does not exist in storage")
+	ErrFileExists   = errorMsg("gulter: file already exists in storage")
+
+	ErrInvalidSignature = errorMsg("gulter: url signature is invalid or has expired")
+)
+
+// MetadataOriginalName is the metadata key the original name of an uploaded
+// file is stored under. The value is escaped with url.PathEscape since some
+// backends only allow ASCII metadata
+const MetadataOriginalName = "original-name"
+
 type UploadFileOptions struct {
 	FileName string
 	Metadata map[string]string
+	// ContentType is the mimetype that was detected for the file. Backends
+	// that support it should persist it alongside the file
+	ContentType string
 }
 
 type UploadedFileMetadata struct {
@@ -25,10 +40,85 @@ type PathOptions struct {
 	IsSecure       bool          `json:"is_secure,omitempty"`
 }
 
+// FileInfo describes a file that already exists in the storage backend
+type FileInfo struct {
+	Key          string            `json:"key,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	LastModified time.Time         `json:"last_modified,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+
+	// FolderDestination is the folder or bucket that holds the file, the
+	// same as UploadedFileMetadata.FolderDestination
+	FolderDestination string `json:"folder_destination,omitempty"`
+}
+
 type Storage interface {
 	// Upload copies the reader to the backend file storage
 	// The name of the file is also provided.
 	Upload(context.Context, io.Reader, *UploadFileOptions) (*UploadedFileMetadata, error)
 	Path(context.Context, PathOptions) (string, error)
+
+	// Get retrieves the file stored with the given key. It is the
+	// responsibility of the caller to close the returned reader.
+	// ErrFileNotFound is returned if the key does not exist
+	Get(context.Context, string) (io.ReadCloser, *FileInfo, error)
+
+	// Stat returns the details of the file stored with the given key without
+	// retrieving its content. ErrFileNotFound is returned if the key does not exist
+	Stat(context.Context, string) (*FileInfo, error)
+
+	// Exists checks if a file has been stored with the given key
+	Exists(context.Context, string) (bool, error)
+
+	// Delete removes the file stored with the given key. Deleting a key that
+	// does not exist is not an error
+	Delete(context.Context, string) error
 	io.Closer
 }
+
+// RangeStorage is implemented by storage backends that can retrieve part of a
+// file without downloading all of it, like S3
+type RangeStorage interface {
+	// GetRange retrieves at most length bytes of the file stored with the
+	// given key starting at offset. ErrFileNotFound is returned if the key
+	// does not exist
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// MultipartUpload identifies an upload that is assembled from parts by the
+// storage backend
+type MultipartUpload struct {
+	Key      string `json:"key,omitempty"`
+	UploadID string `json:"upload_id,omitempty"`
+}
+
+// MultipartPart is a part of a multipart upload that has been stored
+type MultipartPart struct {
+	Number int    `json:"number,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// MultipartStorage is implemented by storage backends that can assemble a
+// file from parts uploaded separately, like S3. Chunked uploads send every
+// chunk straight to the backend instead of keeping it locally
+type MultipartStorage interface {
+	// CreateMultipartUpload starts an upload. The returned key is where the
+	// file will be stored once the upload is complete
+	CreateMultipartUpload(context.Context, *UploadFileOptions) (*MultipartUpload, error)
+
+	// UploadPart stores a single part and returns its ETag. Parts are
+	// numbered from 1 and can be uploaded in any order
+	UploadPart(ctx context.Context, upload *MultipartUpload, partNumber int, r io.ReadSeeker, size int64) (string, error)
+
+	// CompleteMultipartUpload assembles the parts into a single file
+	CompleteMultipartUpload(context.Context, *MultipartUpload, []MultipartPart) (*UploadedFileMetadata, error)
+
+	// AbortMultipartUpload removes the parts of an upload that will never
+	// be completed
+	AbortMultipartUpload(context.Context, *MultipartUpload) error
+
+	// MinPartSize is the smallest size allowed for every part but the last
+	MinPartSize() int64
+}
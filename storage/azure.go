@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/adelowo/gulter"
+	"github.com/ayinke-llc/hermes"
+)
+
+const (
+	defaultAzureBlockSize   = 8 * 1024 * 1024
+	defaultAzureConcurrency = 4
+)
+
+type AzureBlobOptions struct {
+	Container string
+
+	// Prefix is prepended to the name of every blob, so a single container
+	// can be shared. Keys returned by the store do not include it
+	Prefix string
+
+	// Files larger than this are uploaded as staged blocks that are
+	// committed once all of them have been uploaded. Defaults to 8MB
+	BlockSize int64
+
+	// How many blocks of a single file can be uploaded at the same time.
+	// Defaults to 4
+	Concurrency int
+
+	// Layout decides the key files are stored under. Defaults to FlatLayout
+	Layout LayoutFunc
+}
+
+func (o AzureBlobOptions) withDefaults() AzureBlobOptions {
+	if o.BlockSize <= 0 {
+		o.BlockSize = defaultAzureBlockSize
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultAzureConcurrency
+	}
+
+	o.Prefix = strings.Trim(o.Prefix, "/")
+	if o.Prefix != "" {
+		o.Prefix += "/"
+	}
+
+	if o.Layout == nil {
+		o.Layout = FlatLayout
+	}
+
+	return o
+}
+
+type AzureBlobStore struct {
+	client *container.Client
+	opts   AzureBlobOptions
+
+	// canSign is true if the client has a shared key credential to sign
+	// SAS URLs with
+	canSign bool
+}
+
+// NewAzureBlobFromConnectionString creates a store from a storage account
+// connection string. Connection strings with an account key can also sign
+// SAS URLs. Use it with Azurite like this:
+//
+//	storage.NewAzureBlobFromConnectionString("UseDevelopmentStorage=true", opts)
+func NewAzureBlobFromConnectionString(connectionString string, opts AzureBlobOptions) (*AzureBlobStore, error) {
+	if hermes.IsStringEmpty(opts.Container) {
+		return nil, errors.New("please provide a valid azure container")
+	}
+
+	client, err := container.NewClientFromConnectionString(connectionString, opts.Container, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzureBlobFromClient(client, opts)
+}
+
+// NewAzureBlobFromClient creates a store that uses the provided container
+// client. SAS URLs can only be signed if the client was created with a
+// shared key credential
+func NewAzureBlobFromClient(client *container.Client, opts AzureBlobOptions) (*AzureBlobStore, error) {
+	if client == nil {
+		return nil, errors.New("please provide a valid azure container client")
+	}
+
+	_, err := client.GetSASURL(sas.ContainerPermissions{Read: true}, time.Now().Add(time.Minute), nil)
+	if err != nil && !errors.Is(err, bloberror.MissingSharedKeyCredential) {
+		return nil, err
+	}
+
+	return &AzureBlobStore{
+		client:  client,
+		opts:    opts.withDefaults(),
+		canSign: err == nil,
+	}, nil
+}
+
+func (a *AzureBlobStore) Close() error { return nil }
+
+func (a *AzureBlobStore) blob(key string) *blockblob.Client {
+	return a.client.NewBlockBlobClient(a.opts.Prefix + key)
+}
+
+func (a *AzureBlobStore) Upload(ctx context.Context, r io.Reader,
+	opts *gulter.UploadFileOptions,
+) (*gulter.UploadedFileMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := a.opts.Layout(opts.FileName)
+
+	uploadOpts := &blockblob.UploadStreamOptions{
+		BlockSize:   a.opts.BlockSize,
+		Concurrency: a.opts.Concurrency,
+		Metadata:    azureMetadata(opts.Metadata),
+	}
+
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		uploadOpts.HTTPHeaders = &blob.HTTPHeaders{
+			BlobContentType: hermes.Ref(opts.ContentType),
+		}
+	}
+
+	counter := &countingReader{r: r}
+
+	// blocks are only committed once the entire file has been read, so a
+	// failed upload never replaces an existing blob
+	_, err := a.blob(key).UploadStream(ctx, counter, uploadOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gulter.UploadedFileMetadata{
+		FolderDestination: a.opts.Container,
+		Size:              counter.n,
+		Key:               key,
+	}, nil
+}
+
+// RedirectDownloads makes ServeFile redirect clients to a SAS URL so files
+// are downloaded from Azure directly. It is only enabled if the store can
+// sign SAS URLs
+func (a *AzureBlobStore) RedirectDownloads() bool {
+	return a.canSign
+}
+
+func (a *AzureBlobStore) Path(_ context.Context, opts gulter.PathOptions) (string, error) {
+	if !opts.IsSecure {
+		// the sdk escapes the slashes of folders
+		segments := strings.Split(a.opts.Prefix+opts.Key, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+
+		return a.client.URL() + "/" + strings.Join(segments, "/"), nil
+	}
+
+	expiration := opts.ExpirationTime
+	if expiration <= 0 {
+		expiration = defaultSignedURLExpiration
+	}
+
+	signed, err := a.blob(opts.Key).BlobClient().GetSASURL(sas.BlobPermissions{Read: true},
+		time.Now().Add(expiration), nil)
+	if err != nil {
+		return "", fmt.Errorf("gulter: could not sign azure blob url...%w", err)
+	}
+
+	return signed, nil
+}
+
+func (a *AzureBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	resp, err := a.blob(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, nil, azureError(err)
+	}
+
+	return resp.Body, &gulter.FileInfo{
+		Key:          key,
+		Size:         hermes.DeRef(resp.ContentLength),
+		ContentType:  hermes.DeRef(resp.ContentType),
+		LastModified: hermes.DeRef(resp.LastModified),
+		ETag:         string(hermes.DeRef(resp.ETag)),
+		Metadata:     fromAzureMetadata(resp.Metadata),
+
+		FolderDestination: a.opts.Container,
+	}, nil
+}
+
+// GetRange retrieves part of a blob with a ranged download
+func (a *AzureBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := a.blob(key).DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: length},
+	})
+	if err != nil {
+		// the range starts after the end of the blob
+		if bloberror.HasCode(err, bloberror.InvalidRange) {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+
+		return nil, azureError(err)
+	}
+
+	return resp.Body, nil
+}
+
+func (a *AzureBlobStore) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	resp, err := a.blob(key).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, azureError(err)
+	}
+
+	return &gulter.FileInfo{
+		Key:          key,
+		Size:         hermes.DeRef(resp.ContentLength),
+		ContentType:  hermes.DeRef(resp.ContentType),
+		LastModified: hermes.DeRef(resp.LastModified),
+		ETag:         string(hermes.DeRef(resp.ETag)),
+		Metadata:     fromAzureMetadata(resp.Metadata),
+
+		FolderDestination: a.opts.Container,
+	}, nil
+}
+
+func (a *AzureBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := a.Stat(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, gulter.ErrFileNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (a *AzureBlobStore) Delete(ctx context.Context, key string) error {
+	_, err := a.blob(key).Delete(ctx, nil)
+	if err != nil {
+		err = azureError(err)
+		if errors.Is(err, gulter.ErrFileNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// azureError converts the not found errors returned by the blob api into
+// gulter.ErrFileNotFound. Responses to HEAD requests have no body, so they
+// only carry the status code
+func azureError(err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound && respErr.ErrorCode == "" {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	return err
+}
+
+// Blob metadata names must be valid C# identifiers and are case insensitive,
+// so every character other than a lowercase letter, or a digit that is not
+// the first character, is stored as _xx where xx is its hex value.
+// original-name is stored as original_2dname
+func azureMetadata(metadata map[string]string) map[string]*string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	m := make(map[string]*string, len(metadata))
+
+	for k, v := range metadata {
+		var b strings.Builder
+
+		for i, c := range []byte(k) {
+			if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9' && i > 0) {
+				b.WriteByte(c)
+				continue
+			}
+
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+
+		m[b.String()] = hermes.Ref(v)
+	}
+
+	return m
+}
+
+func fromAzureMetadata(metadata map[string]*string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string, len(metadata))
+
+	for k, v := range metadata {
+		// the sdk returns the names as canonical http header names
+		k = strings.ToLower(k)
+
+		var b strings.Builder
+
+		for i := 0; i < len(k); i++ {
+			if k[i] == '_' && i+2 < len(k) {
+				if c, err := strconv.ParseUint(k[i+1:i+3], 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 2
+					continue
+				}
+			}
+
+			b.WriteByte(k[i])
+		}
+
+		m[b.String()] = hermes.DeRef(v)
+	}
+
+	return m
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
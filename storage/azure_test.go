@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureBlobStore_StagedUpload(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeAzureStore(t, AzureBlobOptions{
+		// the sdk does not stage blocks smaller than 1MB
+		BlockSize: 1024 * 1024,
+		Prefix:    "/uploads/",
+	})
+
+	small, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(12), small.Size)
+	require.Equal(t, 1, fake.putBlobCalls)
+	require.Equal(t, 0, fake.stagedBlocks)
+
+	content := bytes.Repeat([]byte("gulter"), 512*1024)
+
+	large, err := store.Upload(ctx, io.MultiReader(bytes.NewReader(content)), &gulter.UploadFileOptions{
+		FileName:    "folder/large.txt",
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "folder/large.txt", large.Key)
+	require.Equal(t, int64(len(content)), large.Size)
+	require.Equal(t, 3, fake.stagedBlocks)
+	require.Equal(t, 1, fake.committedLists)
+
+	_, ok := fake.blobs["uploads/folder/large.txt"]
+	require.True(t, ok, "blobs must be stored under the prefix")
+
+	rc, info, err := store.Get(ctx, large.Key)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	require.True(t, bytes.Equal(content, b))
+	require.Equal(t, "folder/large.txt", info.Key)
+	require.Equal(t, "text/plain", info.ContentType)
+	require.Equal(t, int64(len(content)), info.Size)
+}
+
+func TestAzureBlobStore_Metadata(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeAzureStore(t, AzureBlobOptions{})
+
+	metadata := map[string]string{
+		gulter.MetadataOriginalName: "notes.txt",
+		"Owner":                     "gulter",
+		"2fa_enabled":               "true",
+	}
+
+	_, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+		Metadata: metadata,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"original_2dname": "notes.txt",
+		"_4fwner":         "gulter",
+		"_32fa_5fenabled": "true",
+	}, fake.blobs["gulter.txt"].metadata)
+
+	info, err := store.Stat(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.Equal(t, metadata, info.Metadata)
+}
+
+func TestAzureBlobStore_Path(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeAzureStore(t, AzureBlobOptions{Prefix: "uploads"})
+	require.True(t, store.RedirectDownloads())
+
+	p, err := store.Path(ctx, gulter.PathOptions{Key: "folder/hello gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, fake.server.URL+"/devstoreaccount1/gulter/uploads/folder/hello%20gulter.txt", p)
+
+	p, err = store.Path(ctx, gulter.PathOptions{Key: "gulter.txt", IsSecure: true})
+	require.NoError(t, err)
+
+	u, err := url.Parse(p)
+	require.NoError(t, err)
+	require.Equal(t, "/devstoreaccount1/gulter/uploads/gulter.txt", u.Path)
+	require.Equal(t, "r", u.Query().Get("sp"))
+	require.Equal(t, "b", u.Query().Get("sr"))
+	require.NotEmpty(t, u.Query().Get("sig"))
+	require.NotEmpty(t, u.Query().Get("se"))
+}
+
+func TestAzureBlobStore_RedirectDownloadsWithoutSharedKey(t *testing.T) {
+	fake := newFakeAzure(t, "gulter")
+
+	client, err := container.NewClientWithNoCredential(fake.server.URL+"/devstoreaccount1/gulter", nil)
+	require.NoError(t, err)
+
+	store, err := NewAzureBlobFromClient(client, AzureBlobOptions{Container: "gulter"})
+	require.NoError(t, err)
+	require.False(t, store.RedirectDownloads())
+}
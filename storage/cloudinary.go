@@ -2,8 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"strings"
 
 	"github.com/adelowo/gulter"
 	"github.com/cloudinary/cloudinary-go/v2"
@@ -56,6 +60,10 @@ func (c *CloudinaryStore) Upload(ctx context.Context,
 		return nil, err
 	}
 
+	if resp.Error.Message != "" {
+		return nil, fmt.Errorf("failed to upload asset: %s", resp.Error.Message)
+	}
+
 	return &gulter.UploadedFileMetadata{
 		FolderDestination: "",
 		Size:              int64(resp.Bytes),
@@ -63,12 +71,16 @@ func (c *CloudinaryStore) Upload(ctx context.Context,
 	}, nil
 }
 
+// RedirectDownloads makes ServeFile redirect clients to the Cloudinary URL
+// of the file
+func (c *CloudinaryStore) RedirectDownloads() bool { return true }
+
 func (c *CloudinaryStore) Path(ctx context.Context,
 	opts gulter.PathOptions) (string, error) {
 
-	resp, err := c.client.Admin.Asset(ctx, admin.AssetParams{PublicID: opts.Key})
+	resp, err := c.asset(ctx, opts.Key)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch asset details: %w", err)
+		return "", err
 	}
 
 	var url *asset.Asset
@@ -89,3 +101,125 @@ func (c *CloudinaryStore) Path(ctx context.Context,
 
 	return url.String()
 }
+
+func (c *CloudinaryStore) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	resp, err := c.asset(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resp.SecureURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download asset: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, nil, fmt.Errorf("failed to download asset: unexpected status code %d", res.StatusCode)
+	}
+
+	info := assetToFileInfo(resp)
+	if contentType := res.Header.Get("Content-Type"); contentType != "" {
+		info.ContentType = contentType
+	}
+
+	return res.Body, info, nil
+}
+
+func (c *CloudinaryStore) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	resp, err := c.asset(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return assetToFileInfo(resp), nil
+}
+
+func (c *CloudinaryStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := c.asset(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, gulter.ErrFileNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (c *CloudinaryStore) Delete(ctx context.Context, key string) error {
+	resp, err := c.asset(ctx, key)
+	if err != nil {
+		if errors.Is(err, gulter.ErrFileNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	result, err := c.client.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID:     key,
+		ResourceType: resp.ResourceType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete asset: %w", err)
+	}
+
+	if result.Error.Message != "" {
+		return fmt.Errorf("failed to delete asset: %s", result.Error.Message)
+	}
+
+	return nil
+}
+
+// asset looks up the file across every resource type. The admin api only
+// finds an asset when it is asked for the right resource type and Upload lets
+// Cloudinary pick it
+func (c *CloudinaryStore) asset(ctx context.Context, key string) (*admin.AssetResult, error) {
+	for _, resourceType := range []api.AssetType{api.Image, api.Video, api.File} {
+		resp, err := c.client.Admin.Asset(ctx, admin.AssetParams{
+			AssetType:    resourceType,
+			DeliveryType: api.Upload,
+			PublicID:     key,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch asset details: %w", err)
+		}
+
+		if resp.Error.Message == "" {
+			return resp, nil
+		}
+
+		if !strings.Contains(strings.ToLower(resp.Error.Message), "not found") {
+			return nil, fmt.Errorf("failed to fetch asset details: %s", resp.Error.Message)
+		}
+	}
+
+	return nil, fmt.Errorf("gulter: asset (%s) not found...%w", key, gulter.ErrFileNotFound)
+}
+
+func assetToFileInfo(resp *admin.AssetResult) *gulter.FileInfo {
+	contentType := mime.TypeByExtension("." + resp.Format)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	info := &gulter.FileInfo{
+		Key:          resp.PublicID,
+		Size:         int64(resp.Bytes),
+		ContentType:  contentType,
+		LastModified: resp.CreatedAt,
+	}
+
+	if resp.Etag != "" {
+		info.ETag = fmt.Sprintf("%q", resp.Etag)
+	}
+
+	return info
+}
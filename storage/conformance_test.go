@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/adelowo/gulter/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("disk", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			disk, err := NewDiskStorageWithOptions(t.TempDir(), DiskOptions{
+				BaseURL:    "https://example.com/files",
+				SigningKey: []byte("gulter"),
+			})
+			require.NoError(t, err)
+
+			return disk
+		}, storagetest.WithoutMetadata(), storagetest.WithDetectedContentType())
+	})
+
+	t.Run("disk with a hash layout", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			disk, err := NewDiskStorageWithOptions(t.TempDir(), DiskOptions{
+				BaseURL:    "https://example.com/files",
+				SigningKey: []byte("gulter"),
+				Layout:     HashLayout(2, 2),
+			})
+			require.NoError(t, err)
+
+			return disk
+		}, storagetest.WithoutMetadata(), storagetest.WithDetectedContentType())
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			return NewMemoryStorage(MemoryOptions{})
+		})
+	})
+
+	t.Run("s3", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			_, client := newFakeS3(t, "gulter")
+
+			store, err := NewS3FromClient(client, S3Options{
+				Bucket: "gulter",
+			})
+			require.NoError(t, err)
+
+			return store
+		})
+	})
+
+	t.Run("gcs", func(t *testing.T) {
+		_, privateKey := gcsTestKey(t)
+
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			_, store := newFakeGCSStore(t, GCSOptions{
+				ChunkSize:      gcsChunkAlignment,
+				GoogleAccessID: "gulter@gulter.iam.gserviceaccount.com",
+				PrivateKey:     privateKey,
+			})
+
+			return store
+		})
+	})
+
+	t.Run("azure", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			_, store := newFakeAzureStore(t, AzureBlobOptions{
+				BlockSize: 1024 * 1024,
+				Prefix:    "uploads",
+			})
+
+			return store
+		})
+	})
+
+	t.Run("sftp", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			_, store := newFakeSFTPStore(t, SFTPOptions{
+				RootDir: "/uploads",
+			})
+
+			return store
+		}, storagetest.WithoutMetadata(), storagetest.WithDetectedContentType())
+	})
+
+	t.Run("cloudinary", func(t *testing.T) {
+		storagetest.RunConformance(t, func(t *testing.T) gulter.Storage {
+			_, store := newFakeCloudinaryStore(t, CloudinaryOptions{
+				OverwriteExistingFile: true,
+			})
+
+			return store
+		}, storagetest.WithoutMetadata(), storagetest.WithDetectedContentType())
+	})
+}
+
+func TestNewS3FromEnvironment(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "gulter")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "gulter")
+
+	_, err := NewS3FromEnvironment(S3Options{})
+	require.Error(t, err)
+
+	store, err := NewS3FromEnvironment(S3Options{
+		Bucket:           "gulter",
+		CloudflareDomain: "https://files.example.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "gulter", store.bucket)
+	require.Equal(t, "https://files.example.com", store.cloudflareDomain)
+}
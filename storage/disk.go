@@ -2,60 +2,397 @@ package storage
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/adelowo/gulter"
 	"github.com/ayinke-llc/hermes"
 )
 
+// DiskConflict decides what happens when a file is uploaded with the same
+// name as an existing file
+type DiskConflict int
+
+const (
+	// DiskConflictOverwrite replaces the existing file
+	DiskConflictOverwrite DiskConflict = iota
+
+	// DiskConflictFail fails the upload with gulter.ErrFileExists
+	DiskConflictFail
+
+	// DiskConflictRename stores the file under a new name by adding a
+	// numbered suffix, notes.txt becomes notes-1.txt as an example
+	DiskConflictRename
+)
+
+// maxDiskRenameAttempts is how many suffixes are tried before giving up
+// with DiskConflictRename
+const maxDiskRenameAttempts = 1000
+
+type DiskOptions struct {
+	// Permissions of uploaded files. Defaults to 0644
+	FilePermissions os.FileMode
+
+	// Permissions of the folders created when a key contains a folder.
+	// Defaults to 0755
+	DirPermissions os.FileMode
+
+	// What happens when a file with the same name already exists.
+	// Defaults to DiskConflictOverwrite
+	OnConflict DiskConflict
+
+	// Layout decides the folders files are stored in. Folders are created
+	// as needed. Defaults to FlatLayout
+	Layout LayoutFunc
+
+	// Files are written to a temporary file first and moved into place once
+	// they have been completely written. If the upload fails, the temporary
+	// file is removed unless this is true
+	KeepPartialFiles bool
+
+	// BaseURL is where DownloadHandler is mounted, like
+	// https://example.com/files. If provided, Path returns HTTP URLs instead
+	// of paths on the filesystem
+	BaseURL string
+
+	// SigningKey is used to sign the URLs returned by Path when IsSecure is
+	// set. Signed URLs expire and cannot be tampered with. Once a key is
+	// provided, DownloadHandler rejects URLs that are not signed
+	SigningKey []byte
+
+	// AllowUnsignedURLs makes DownloadHandler serve URLs without a signature
+	// even if a SigningKey is provided, like a public S3 bucket. Signed URLs
+	// are still verified
+	AllowUnsignedURLs bool
+}
+
+func (o DiskOptions) withDefaults() DiskOptions {
+	if o.FilePermissions == 0 {
+		o.FilePermissions = 0o644
+	}
+
+	if o.DirPermissions == 0 {
+		o.DirPermissions = 0o755
+	}
+
+	if o.Layout == nil {
+		o.Layout = FlatLayout
+	}
+
+	return o
+}
+
+// Disk stores files in a local folder. All files are confined to that
+// folder, keys that would escape it, directly or through a symlink, are
+// rejected
 type Disk struct {
 	folder string
+	root   *os.Root
+	opts   DiskOptions
+	now    func() time.Time
 }
 
 func NewDiskStorage(pathToFolder string) (*Disk, error) {
+	return NewDiskStorageWithOptions(pathToFolder, DiskOptions{})
+}
+
+func NewDiskStorageWithOptions(pathToFolder string, opts DiskOptions) (*Disk, error) {
 	if hermes.IsStringEmpty(pathToFolder) {
 		return nil, errors.New("please provide a bucket")
 	}
 
-	if _, err := os.Stat(pathToFolder); err != nil {
+	root, err := os.OpenRoot(pathToFolder)
+	if err != nil {
 		return nil, err
 	}
 
 	return &Disk{
 		folder: pathToFolder,
+		root:   root,
+		opts:   opts.withDefaults(),
+		now:    time.Now,
 	}, nil
 }
 
-func (d *Disk) Close() error { return nil }
+func (d *Disk) Close() error { return d.root.Close() }
 
+// Upload writes the file to a temporary file in the same folder, flushes it
+// to disk and only then moves it to its final name. Readers never see a
+// partially written file even if the upload fails or the process crashes
 func (d *Disk) Upload(ctx context.Context, r io.Reader,
 	opts *gulter.UploadFileOptions,
 ) (*gulter.UploadedFileMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := filepath.FromSlash(d.opts.Layout(opts.FileName))
+
+	if !filepath.IsLocal(key) {
+		return nil, fmt.Errorf("gulter: key (%s) escapes the storage folder", key)
+	}
+
+	dir := filepath.Dir(key)
+	if dir != "." {
+		if err := d.root.MkdirAll(dir, d.opts.DirPermissions); err != nil {
+			return nil, err
+		}
+	}
 
-	f, err := os.Create(filepath.Join(d.folder, opts.FileName))
+	tmp, n, err := d.writeTemp(dir, &contextReader{ctx: ctx, r: r})
 	if err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	// the upload could have been cancelled after the last read
+	if err := ctx.Err(); err != nil {
+		if !d.opts.KeepPartialFiles {
+			_ = d.root.Remove(tmp)
+		}
 
-	n, err := io.Copy(f, r)
+		return nil, err
+	}
+
+	key, err = d.place(tmp, key)
 	if err != nil {
+		if !d.opts.KeepPartialFiles {
+			_ = d.root.Remove(tmp)
+		}
+
 		return nil, err
 	}
 
+	// the rename is only durable once the folder itself has been flushed.
+	// Not every platform supports this, so it is done on a best effort basis
+	if f, err := d.root.Open(dir); err == nil {
+		_ = f.Sync()
+		_ = f.Close()
+	}
+
 	return &gulter.UploadedFileMetadata{
-		FolderDestination: d.folder,
+		FolderDestination: filepath.Join(d.folder, filepath.Dir(key)),
 		Size:              n,
-		Key:               opts.FileName,
-	}, err
+		Key:               filepath.ToSlash(key),
+	}, nil
+}
+
+// writeTemp copies r into a new temporary file in dir and flushes it to disk
+func (d *Disk) writeTemp(dir string, r io.Reader) (string, int64, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+
+	tmp := filepath.Join(dir, ".gulter-tmp-"+hex.EncodeToString(b))
+
+	f, err := d.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, d.opts.FilePermissions)
+	if err != nil {
+		return "", 0, err
+	}
+
+	n, err := d.copy(f, r)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		if !d.opts.KeepPartialFiles {
+			_ = d.root.Remove(tmp)
+		}
+
+		return "", 0, err
+	}
+
+	return tmp, n, nil
+}
+
+func (d *Disk) copy(f *os.File, r io.Reader) (int64, error) {
+	// the umask could have removed some of the permissions
+	if err := f.Chmod(d.opts.FilePermissions); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.Sync()
+}
+
+// place moves the temporary file to its final name and returns the key it
+// was stored under
+func (d *Disk) place(tmp, key string) (string, error) {
+	switch d.opts.OnConflict {
+	case DiskConflictFail:
+		if err := d.link(tmp, key); err != nil {
+			return "", err
+		}
+
+		return key, d.root.Remove(tmp)
+
+	case DiskConflictRename:
+		ext := filepath.Ext(key)
+		name := strings.TrimSuffix(key, ext)
+
+		for i := 0; i <= maxDiskRenameAttempts; i++ {
+			candidate := key
+			if i > 0 {
+				candidate = fmt.Sprintf("%s-%d%s", name, i, ext)
+			}
+
+			err := d.link(tmp, candidate)
+			if errors.Is(err, gulter.ErrFileExists) {
+				continue
+			}
+
+			if err != nil {
+				return "", err
+			}
+
+			return candidate, d.root.Remove(tmp)
+		}
+
+		return "", fmt.Errorf("gulter: could not find a free name for (%s)...%w", key, gulter.ErrFileExists)
+
+	default:
+		return key, d.root.Rename(tmp, key)
+	}
+}
+
+// link creates key as a hard link to tmp. Unlike a rename, this fails if
+// key already exists
+func (d *Disk) link(tmp, key string) error {
+	err := d.root.Link(tmp, key)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileExists)
+	}
+
+	return err
 }
 
 func (d *Disk) Path(ctx context.Context,
 	opts gulter.PathOptions) (string, error) {
-	return fmt.Sprintf("%s/%s", d.folder, opts.Key), nil
+	if !filepath.IsLocal(opts.Key) {
+		return "", fmt.Errorf("gulter: key (%s) escapes the storage folder", opts.Key)
+	}
+
+	if hermes.IsStringEmpty(d.opts.BaseURL) {
+		return fmt.Sprintf("%s/%s", d.folder, opts.Key), nil
+	}
+
+	return d.url(opts)
+}
+
+func (d *Disk) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	f, err := d.root.Open(key)
+	if err != nil {
+		return nil, nil, diskError(err)
+	}
+
+	info, err := d.fileInfo(key, f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+func (d *Disk) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	f, err := d.root.Open(key)
+	if err != nil {
+		return nil, diskError(err)
+	}
+
+	defer f.Close()
+
+	return d.fileInfo(key, f)
+}
+
+func (d *Disk) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := d.root.Stat(key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	err := d.root.Remove(key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// fileInfo builds the file details. Since we do not store any extra
+// metadata on disk, the content type is sniffed from the file itself
+func (d *Disk) fileInfo(key string, f *os.File) (*gulter.FileInfo, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s is a directory...%w", key, gulter.ErrFileNotFound)
+	}
+
+	buf := make([]byte, 512)
+
+	n, err := f.Read(buf)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &gulter.FileInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  http.DetectContentType(buf[:n]),
+		LastModified: stat.ModTime(),
+		ETag:         fmt.Sprintf(`W/"%x-%x"`, stat.Size(), stat.ModTime().UnixNano()),
+
+		FolderDestination: filepath.Join(d.folder, filepath.Dir(key)),
+	}, nil
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+func diskError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	return err
 }
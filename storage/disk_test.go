@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisk_FileLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	disk, err := NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	metadata, err := disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(12), metadata.Size)
+
+	exists, err := disk.Exists(ctx, metadata.Key)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	info, err := disk.Stat(ctx, metadata.Key)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), info.Size)
+	require.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+
+	rc, info, err := disk.Get(ctx, metadata.Key)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "hello gulter", string(b))
+	require.Equal(t, int64(12), info.Size)
+
+	require.NoError(t, disk.Delete(ctx, metadata.Key))
+
+	// deleting twice should not fail
+	require.NoError(t, disk.Delete(ctx, metadata.Key))
+
+	exists, err = disk.Exists(ctx, metadata.Key)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = disk.Stat(ctx, metadata.Key)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	_, _, err = disk.Get(ctx, metadata.Key)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestDisk_ConfinedToFolder(t *testing.T) {
+	ctx := context.Background()
+
+	parent := t.TempDir()
+	folder := filepath.Join(parent, "uploads")
+
+	require.NoError(t, os.Mkdir(folder, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0o600))
+
+	// a symlink inside the folder that points outside of it
+	require.NoError(t, os.Symlink(filepath.Join(parent, "secret.txt"), filepath.Join(folder, "link.txt")))
+
+	disk, err := NewDiskStorage(folder)
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	_, err = disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "../escape.txt",
+	})
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(parent, "escape.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, _, err = disk.Get(ctx, "../secret.txt")
+	require.Error(t, err)
+
+	_, _, err = disk.Get(ctx, "link.txt")
+	require.Error(t, err)
+
+	// the symlink itself is replaced, the file it points to is left untouched
+	_, err = disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "link.txt",
+	})
+	require.NoError(t, err)
+
+	stat, err := os.Lstat(filepath.Join(folder, "link.txt"))
+	require.NoError(t, err)
+	require.True(t, stat.Mode().IsRegular())
+
+	b, err := os.ReadFile(filepath.Join(parent, "secret.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(b))
+
+	require.Error(t, disk.Delete(ctx, "../secret.txt"))
+
+	_, err = disk.Path(ctx, gulter.PathOptions{Key: "../secret.txt"})
+	require.Error(t, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return copy(p, "partial"), errors.New("connection reset")
+}
+
+func TestDisk_Upload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("failed uploads do not leave partial files behind", func(t *testing.T) {
+		folder := t.TempDir()
+
+		disk, err := NewDiskStorage(folder)
+		require.NoError(t, err)
+
+		defer disk.Close()
+
+		_, err = disk.Upload(ctx, failingReader{}, &gulter.UploadFileOptions{
+			FileName: "gulter.txt",
+		})
+		require.Error(t, err)
+
+		entries, err := os.ReadDir(folder)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("partial files can be kept", func(t *testing.T) {
+		folder := t.TempDir()
+
+		disk, err := NewDiskStorageWithOptions(folder, DiskOptions{KeepPartialFiles: true})
+		require.NoError(t, err)
+
+		defer disk.Close()
+
+		_, err = disk.Upload(ctx, failingReader{}, &gulter.UploadFileOptions{
+			FileName: "gulter.txt",
+		})
+		require.Error(t, err)
+
+		entries, err := os.ReadDir(folder)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.NotEqual(t, "gulter.txt", entries[0].Name())
+	})
+
+	t.Run("permissions and nested folders", func(t *testing.T) {
+		folder := t.TempDir()
+
+		disk, err := NewDiskStorageWithOptions(folder, DiskOptions{
+			FilePermissions: 0o600,
+			DirPermissions:  0o700,
+		})
+		require.NoError(t, err)
+
+		defer disk.Close()
+
+		metadata, err := disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+			FileName: "avatars/gulter.txt",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "avatars/gulter.txt", metadata.Key)
+
+		stat, err := os.Stat(filepath.Join(folder, "avatars", "gulter.txt"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+		stat, err = os.Stat(filepath.Join(folder, "avatars"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o700), stat.Mode().Perm())
+	})
+
+	tt := []struct {
+		name            string
+		conflict        DiskConflict
+		hasError        bool
+		expectedKey     string
+		expectedContent string
+	}{
+		{
+			name:            "overwrite existing files",
+			conflict:        DiskConflictOverwrite,
+			expectedKey:     "gulter.txt",
+			expectedContent: "second",
+		},
+		{
+			name:            "fail on existing files",
+			conflict:        DiskConflictFail,
+			hasError:        true,
+			expectedKey:     "gulter.txt",
+			expectedContent: "first",
+		},
+		{
+			name:            "rename on existing files",
+			conflict:        DiskConflictRename,
+			expectedKey:     "gulter-1.txt",
+			expectedContent: "second",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			folder := t.TempDir()
+
+			disk, err := NewDiskStorageWithOptions(folder, DiskOptions{OnConflict: v.conflict})
+			require.NoError(t, err)
+
+			defer disk.Close()
+
+			_, err = disk.Upload(ctx, strings.NewReader("first"), &gulter.UploadFileOptions{
+				FileName: "gulter.txt",
+			})
+			require.NoError(t, err)
+
+			metadata, err := disk.Upload(ctx, strings.NewReader("second"), &gulter.UploadFileOptions{
+				FileName: "gulter.txt",
+			})
+			if v.hasError {
+				require.ErrorIs(t, err, gulter.ErrFileExists)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, v.expectedKey, metadata.Key)
+			}
+
+			b, err := os.ReadFile(filepath.Join(folder, v.expectedKey))
+			require.NoError(t, err)
+			require.Equal(t, v.expectedContent, string(b))
+
+			// no temporary files are left behind
+			entries, err := os.ReadDir(folder)
+			require.NoError(t, err)
+
+			for _, entry := range entries {
+				require.False(t, strings.HasPrefix(entry.Name(), ".gulter-tmp-"))
+			}
+		})
+	}
+}
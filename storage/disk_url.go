@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adelowo/gulter"
+)
+
+// defaultSignedURLExpiration is how long signed URLs are valid for if
+// PathOptions.ExpirationTime is not provided
+const defaultSignedURLExpiration = 15 * time.Minute
+
+// url builds the HTTP URL of a file. It is signed if opts.IsSecure is set
+func (d *Disk) url(opts gulter.PathOptions) (string, error) {
+	segments := strings.Split(opts.Key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	u := strings.TrimSuffix(d.opts.BaseURL, "/") + "/" + strings.Join(segments, "/")
+
+	if !opts.IsSecure {
+		return u, nil
+	}
+
+	if len(d.opts.SigningKey) == 0 {
+		return "", errors.New("gulter: a signing key is required to generate secure urls")
+	}
+
+	expiration := opts.ExpirationTime
+	if expiration <= 0 {
+		expiration = defaultSignedURLExpiration
+	}
+
+	expires := strconv.FormatInt(d.now().Add(expiration).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", d.sign(opts.Key, expires))
+
+	return u + "?" + query.Encode(), nil
+}
+
+func (d *Disk) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, d.opts.SigningKey)
+	mac.Write([]byte(key + "\n" + expires))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify makes sure the signature of a URL is valid and has not expired.
+// URLs without a signature are only accepted if there is no SigningKey or
+// AllowUnsignedURLs is set
+func (d *Disk) verify(key string, query url.Values) error {
+	signature := query.Get("signature")
+	expires := query.Get("expires")
+
+	if len(d.opts.SigningKey) == 0 {
+		if signature == "" && expires == "" {
+			return nil
+		}
+
+		return gulter.ErrInvalidSignature
+	}
+
+	if signature == "" && expires == "" {
+		if d.opts.AllowUnsignedURLs {
+			return nil
+		}
+
+		return fmt.Errorf("url is not signed...%w", gulter.ErrInvalidSignature)
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry...%w", gulter.ErrInvalidSignature)
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(d.sign(key, expires))) {
+		return gulter.ErrInvalidSignature
+	}
+
+	if d.now().Unix() > expiresAt {
+		return fmt.Errorf("url expired...%w", gulter.ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// DownloadHandler serves the files of this storage at DiskOptions.BaseURL.
+// Signed URLs returned by Path are verified and rejected if they have been
+// tampered with or have expired. If a SigningKey is provided, URLs that are
+// not signed are rejected unless AllowUnsignedURLs is set
+func (d *Disk) DownloadHandler(opts *gulter.ServeOptions) http.Handler {
+	prefix := "/"
+	if u, err := url.Parse(d.opts.BaseURL); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok || key == "" {
+			gulter.ServeError(w, r, gulter.ErrFileNotFound, opts)
+			return
+		}
+
+		if err := d.verify(key, r.URL.Query()); err != nil {
+			gulter.ServeError(w, r, err, opts)
+			return
+		}
+
+		gulter.ServeFile(w, r, d, key, opts)
+	})
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisk_SignedURLs(t *testing.T) {
+	ctx := context.Background()
+
+	disk, err := NewDiskStorageWithOptions(t.TempDir(), DiskOptions{
+		BaseURL:    "https://example.com/files",
+		SigningKey: []byte("gulter"),
+	})
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	now := time.Date(2026, time.October, 17, 12, 0, 0, 0, time.UTC)
+	disk.now = func() time.Time { return now }
+
+	_, err = disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "avatars/my notes.txt",
+	})
+	require.NoError(t, err)
+
+	p, err := disk.Path(ctx, gulter.PathOptions{Key: "avatars/my notes.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/files/avatars/my%20notes.txt", p)
+
+	signed, err := disk.Path(ctx, gulter.PathOptions{
+		Key:            "avatars/my notes.txt",
+		IsSecure:       true,
+		ExpirationTime: time.Minute,
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	require.Equal(t, "1792238460", u.Query().Get("expires"))
+
+	tampered := *u
+	query := tampered.Query()
+	query.Set("expires", "1892238460")
+	tampered.RawQuery = query.Encode()
+
+	otherFile := *u
+	otherFile.Path = "/files/avatars/other.txt"
+	otherFile.RawPath = ""
+
+	handler := disk.DownloadHandler(nil)
+
+	tt := []struct {
+		name               string
+		url                string
+		at                 time.Time
+		allowUnsigned      bool
+		expectedStatusCode int
+	}{
+		{
+			name:               "valid signature",
+			url:                signed,
+			at:                 now,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "unsigned url",
+			url:                p,
+			at:                 now,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "signed url without its query",
+			url:                strings.SplitN(signed, "?", 2)[0],
+			at:                 now,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "unsigned url allowed",
+			url:                p,
+			at:                 now,
+			allowUnsigned:      true,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "tampered expiry with unsigned urls allowed",
+			url:                tampered.String(),
+			at:                 now,
+			allowUnsigned:      true,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "tampered expiry",
+			url:                tampered.String(),
+			at:                 now,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "signature of another file",
+			url:                otherFile.String(),
+			at:                 now,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "expired url",
+			url:                signed,
+			at:                 now.Add(2 * time.Minute),
+			expectedStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			disk.now = func() time.Time { return v.at }
+			disk.opts.AllowUnsignedURLs = v.allowUnsigned
+
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, v.url, nil))
+
+			require.Equal(t, v.expectedStatusCode, recorder.Code)
+
+			if v.expectedStatusCode == http.StatusOK {
+				require.Equal(t, "hello gulter", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestDisk_URLsWithoutSigningKey(t *testing.T) {
+	disk, err := NewDiskStorageWithOptions(t.TempDir(), DiskOptions{
+		BaseURL: "https://example.com/files/",
+	})
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	p, err := disk.Path(context.Background(), gulter.PathOptions{Key: "gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/files/gulter.txt", p)
+
+	_, err = disk.Path(context.Background(), gulter.PathOptions{Key: "gulter.txt", IsSecure: true})
+	require.Error(t, err)
+}
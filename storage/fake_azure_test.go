@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// the well known Azurite development account
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+type fakeAzureBlob struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+func (b fakeAzureBlob) etag() string {
+	sum := md5.Sum(b.data)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+}
+
+// fakeAzure is an in-process implementation of the subset of the blob api
+// used by AzureBlobStore. Requests are not authenticated
+type fakeAzure struct {
+	mu sync.Mutex
+
+	server    *httptest.Server
+	container string
+	blobs     map[string]fakeAzureBlob
+
+	// uncommitted blocks by blob name and block id
+	blocks map[string]map[string][]byte
+
+	putBlobCalls   int
+	stagedBlocks   int
+	committedLists int
+}
+
+func newFakeAzure(t *testing.T, containerName string) *fakeAzure {
+	t.Helper()
+
+	fake := &fakeAzure{
+		container: containerName,
+		blobs:     make(map[string]fakeAzureBlob),
+		blocks:    make(map[string]map[string][]byte),
+	}
+
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func (f *fakeAzure) connectionString() string {
+	return fmt.Sprintf("DefaultEndpointsProtocol=http;AccountName=%s;AccountKey=%s;BlobEndpoint=%s/%s;",
+		azuriteAccount, azuriteKey, f.server.URL, azuriteAccount)
+}
+
+func newFakeAzureStore(t *testing.T, opts AzureBlobOptions) (*fakeAzure, *AzureBlobStore) {
+	t.Helper()
+
+	fake := newFakeAzure(t, "gulter")
+
+	client, err := container.NewClientFromConnectionString(fake.connectionString(), "gulter", &container.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Retry: policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Container = "gulter"
+
+	store, err := NewAzureBlobFromClient(client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, store
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("x-ms-request-id", "gulter")
+	w.Header().Set("x-ms-version", r.Header.Get("x-ms-version"))
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/"+azuriteAccount+"/"+f.container+"/")
+	if !ok || name == "" {
+		f.writeError(w, r, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "block":
+		f.stageBlock(w, r, name)
+
+	case r.Method == http.MethodPut && r.URL.Query().Get("comp") == "blocklist":
+		f.commitBlockList(w, r, name)
+
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, r, http.StatusBadRequest, "InvalidInput")
+			return
+		}
+
+		f.putBlobCalls++
+		f.store(w, r, name, data)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		blob, ok := f.blobs[name]
+		if !ok {
+			f.writeError(w, r, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+
+		data, contentRange, err := fakeRange(r.Header.Get("x-ms-range"), blob.data)
+		if err != nil {
+			f.writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+
+		status := http.StatusOK
+		if contentRange != "" {
+			w.Header().Set("Content-Range", contentRange)
+			status = http.StatusPartialContent
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Content-Type", blob.contentType)
+		w.Header().Set("ETag", blob.etag())
+		w.Header().Set("Last-Modified", blob.lastModified.Format(http.TimeFormat))
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+
+		for k, v := range blob.metadata {
+			w.Header()["x-ms-meta-"+k] = []string{v}
+		}
+
+		w.WriteHeader(status)
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[name]; !ok {
+			f.writeError(w, r, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		f.writeError(w, r, http.StatusMethodNotAllowed, "UnsupportedHttpVerb")
+	}
+}
+
+func (f *fakeAzure) stageBlock(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.writeError(w, r, http.StatusBadRequest, "InvalidInput")
+		return
+	}
+
+	if f.blocks[name] == nil {
+		f.blocks[name] = make(map[string][]byte)
+	}
+
+	f.blocks[name][r.URL.Query().Get("blockid")] = data
+	f.stagedBlocks++
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeAzure) commitBlockList(w http.ResponseWriter, r *http.Request, name string) {
+	var list struct {
+		Latest []string `xml:"Latest"`
+	}
+
+	if err := xml.NewDecoder(r.Body).Decode(&list); err != nil {
+		f.writeError(w, r, http.StatusBadRequest, "InvalidXmlDocument")
+		return
+	}
+
+	var data []byte
+
+	for _, id := range list.Latest {
+		block, ok := f.blocks[name][id]
+		if !ok {
+			f.writeError(w, r, http.StatusBadRequest, "InvalidBlockList")
+			return
+		}
+
+		data = append(data, block...)
+	}
+
+	delete(f.blocks, name)
+	f.committedLists++
+
+	f.store(w, r, name, data)
+}
+
+func (f *fakeAzure) store(w http.ResponseWriter, r *http.Request, name string, data []byte) {
+	blob := fakeAzureBlob{
+		data:         data,
+		contentType:  r.Header.Get("x-ms-blob-content-type"),
+		metadata:     make(map[string]string),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if blob.contentType == "" {
+		blob.contentType = "application/octet-stream"
+	}
+
+	for k, v := range r.Header {
+		if key, ok := strings.CutPrefix(strings.ToLower(k), "x-ms-meta-"); ok {
+			blob.metadata[key] = v[0]
+		}
+	}
+
+	f.blobs[name] = blob
+
+	w.Header().Set("ETag", blob.etag())
+	w.Header().Set("Last-Modified", blob.lastModified.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeAzure) writeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`,
+		code, http.StatusText(status))
+}
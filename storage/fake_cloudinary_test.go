@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeCloudinaryAsset struct {
+	data         []byte
+	resourceType string
+	format       string
+	createdAt    time.Time
+}
+
+// fakeCloudinary is an in-process implementation of the subset of the
+// Cloudinary upload and admin apis used by CloudinaryStore
+type fakeCloudinary struct {
+	mu sync.Mutex
+
+	server *httptest.Server
+	cloud  string
+	assets map[string]fakeCloudinaryAsset
+}
+
+func newFakeCloudinary(t *testing.T, cloud string) *fakeCloudinary {
+	t.Helper()
+
+	fake := &fakeCloudinary{
+		cloud:  cloud,
+		assets: make(map[string]fakeCloudinaryAsset),
+	}
+
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func newFakeCloudinaryStore(t *testing.T, opts CloudinaryOptions) (*fakeCloudinary, *CloudinaryStore) {
+	t.Helper()
+
+	fake := newFakeCloudinary(t, "gulter")
+
+	opts.CloudName = "gulter"
+	opts.APIKey = "gulter"
+	opts.APISecret = "gulter"
+
+	store, err := NewCloudinary(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.client.Config.API.UploadPrefix = fake.server.URL
+	store.client.Upload.Config.API.UploadPrefix = fake.server.URL
+	store.client.Admin.Config.API.UploadPrefix = fake.server.URL
+
+	return fake, store
+}
+
+func (f *fakeCloudinary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if publicID, ok := strings.CutPrefix(r.URL.Path, "/download/"); ok {
+		f.download(w, publicID)
+		return
+	}
+
+	endpoint, ok := strings.CutPrefix(r.URL.Path, "/v1_1/"+f.cloud+"/")
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "Invalid cloud name")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(endpoint, "/upload"):
+		f.upload(w, r)
+
+	case r.Method == http.MethodPost && strings.HasSuffix(endpoint, "/destroy"):
+		f.destroy(w, r)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(endpoint, "resources/"):
+		// resources/{resource_type}/upload/{public_id}
+		parts := strings.SplitN(strings.TrimPrefix(endpoint, "resources/"), "/", 3)
+		if len(parts) != 3 {
+			f.writeError(w, http.StatusBadRequest, "Invalid resource")
+			return
+		}
+
+		publicID := parts[2]
+
+		asset, ok := f.assets[publicID]
+		if !ok || asset.resourceType != parts[0] {
+			f.writeError(w, http.StatusNotFound, "Resource not found - "+publicID)
+			return
+		}
+
+		f.writeJSON(w, http.StatusOK, f.assetResponse(publicID, asset))
+
+	default:
+		f.writeError(w, http.StatusNotFound, "Unsupported endpoint")
+	}
+}
+
+func (f *fakeCloudinary) upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid upload")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Missing required parameter - file")
+		return
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid upload")
+		return
+	}
+
+	publicID := r.FormValue("public_id")
+
+	if existing, ok := f.assets[publicID]; ok && r.FormValue("overwrite") == "false" {
+		response := f.assetResponse(publicID, existing)
+		response["existing"] = true
+
+		f.writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	resourceType := "raw"
+
+	contentType := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		resourceType = "image"
+	case strings.HasPrefix(contentType, "video/"):
+		resourceType = "video"
+	}
+
+	asset := fakeCloudinaryAsset{
+		data:         data,
+		resourceType: resourceType,
+		format:       strings.TrimPrefix(path.Ext(publicID), "."),
+		createdAt:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	f.assets[publicID] = asset
+
+	f.writeJSON(w, http.StatusOK, f.assetResponse(publicID, asset))
+}
+
+func (f *fakeCloudinary) destroy(w http.ResponseWriter, r *http.Request) {
+	// the sdk sends the form without a content type
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	publicID := form.Get("public_id")
+
+	if _, ok := f.assets[publicID]; !ok {
+		f.writeJSON(w, http.StatusOK, map[string]string{"result": "not found"})
+		return
+	}
+
+	delete(f.assets, publicID)
+
+	f.writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+}
+
+func (f *fakeCloudinary) download(w http.ResponseWriter, publicID string) {
+	asset, ok := f.assets[publicID]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if contentType := mime.TypeByExtension("." + asset.format); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	_, _ = w.Write(asset.data)
+}
+
+func (f *fakeCloudinary) assetResponse(publicID string, asset fakeCloudinaryAsset) map[string]any {
+	sum := md5.Sum(asset.data)
+
+	return map[string]any{
+		"public_id":     publicID,
+		"format":        asset.format,
+		"resource_type": asset.resourceType,
+		"type":          "upload",
+		"bytes":         len(asset.data),
+		"created_at":    asset.createdAt,
+		"etag":          hex.EncodeToString(sum[:]),
+		"secure_url":    f.server.URL + "/download/" + publicID,
+	}
+}
+
+func (f *fakeCloudinary) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeCloudinary) writeError(w http.ResponseWriter, status int, message string) {
+	f.writeJSON(w, status, map[string]any{
+		"error": map[string]string{"message": message},
+	})
+}
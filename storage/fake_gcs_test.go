@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+type fakeGCSObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+	generation  int64
+	updated     time.Time
+}
+
+type fakeGCSSession struct {
+	name        string
+	contentType string
+	metadata    map[string]string
+	data        []byte
+
+	// the generation the object must have for the upload to succeed, 0 if
+	// it must not exist. Empty if the upload has no precondition
+	ifGenerationMatch string
+}
+
+// fakeGCS is an in-process implementation of the subset of the GCS json
+// api used by GCSStore
+type fakeGCS struct {
+	mu sync.Mutex
+
+	server   *httptest.Server
+	bucket   string
+	objects  map[string]fakeGCSObject
+	sessions map[string]*fakeGCSSession
+
+	nextID     int64
+	chunks     int
+	generation int64
+
+	// the next failures requests to upload a file fail with a 503
+	failures int
+
+	// beforeUpload is called with the lock held when an upload is started
+	beforeUpload func()
+}
+
+func newFakeGCS(t *testing.T, bucket string) *fakeGCS {
+	t.Helper()
+
+	fake := &fakeGCS{
+		bucket:   bucket,
+		objects:  make(map[string]fakeGCSObject),
+		sessions: make(map[string]*fakeGCSSession),
+	}
+
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func newFakeGCSStore(t *testing.T, opts GCSOptions) (*fakeGCS, *GCSStore) {
+	t.Helper()
+
+	fake := newFakeGCS(t, "gulter")
+
+	opts.Bucket = "gulter"
+	opts.Endpoint = fake.server.URL + "/storage/v1/"
+
+	store, err := NewGCS(context.Background(), opts,
+		option.WithoutAuthentication(), gcs.WithJSONReads())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, store
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	uploadPrefix := "/upload/storage/v1/b/" + f.bucket + "/o"
+	objectPrefix := "/storage/v1/b/" + f.bucket + "/o/"
+
+	if r.URL.Path == uploadPrefix && f.failures > 0 {
+		f.failures--
+		f.writeError(w, http.StatusServiceUnavailable, "Service Unavailable")
+		return
+	}
+
+	switch {
+	case r.URL.Path == uploadPrefix && r.Method == http.MethodPost &&
+		r.URL.Query().Get("uploadType") == "multipart":
+		f.uploadMultipart(w, r)
+
+	// chunks are sent to the session with POST requests too
+	case r.URL.Path == uploadPrefix && r.Method == http.MethodPost &&
+		r.URL.Query().Has("upload_id"):
+		f.uploadChunk(w, r)
+
+	case r.URL.Path == uploadPrefix && r.Method == http.MethodPost:
+		f.createSession(w, r)
+
+	case strings.HasPrefix(r.URL.EscapedPath(), objectPrefix):
+		name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), objectPrefix))
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "Invalid object name")
+			return
+		}
+
+		f.object(w, r, name)
+
+	default:
+		f.writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *fakeGCS) createSession(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("uploadType") != "resumable" {
+		f.writeError(w, http.StatusBadRequest, "Unsupported upload type")
+		return
+	}
+
+	var session fakeGCSSession
+	if err := f.decodeResource(r, r.Body, &session); err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid object resource")
+		return
+	}
+
+	f.nextID++
+	id := strconv.FormatInt(f.nextID, 10)
+
+	f.sessions[id] = &session
+
+	w.Header().Set("Location", fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&upload_id=%s",
+		f.server.URL, f.bucket, id))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeGCS) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	session, ok := f.sessions[r.URL.Query().Get("upload_id")]
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "No such upload")
+		return
+	}
+
+	chunk, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid chunk")
+		return
+	}
+
+	span, total, ok := strings.Cut(strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes "), "/")
+	if !ok {
+		f.writeError(w, http.StatusBadRequest, "Invalid Content-Range")
+		return
+	}
+
+	if span != "*" {
+		var start, end int
+		if _, err := fmt.Sscanf(span, "%d-%d", &start, &end); err != nil ||
+			start != len(session.data) || end-start+1 != len(chunk) {
+			f.writeError(w, http.StatusBadRequest, "Invalid Content-Range")
+			return
+		}
+	}
+
+	if total == "*" && len(chunk)%gcsChunkAlignment != 0 {
+		f.writeError(w, http.StatusBadRequest, "Chunks must be a multiple of 256KB")
+		return
+	}
+
+	f.chunks++
+	session.data = append(session.data, chunk...)
+
+	if total == "*" {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(session.data)-1))
+
+		// clients that cannot handle a 308 that is not a redirect ask
+		// for a 200 instead
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-HTTP-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+
+	if total != strconv.Itoa(len(session.data)) {
+		f.writeError(w, http.StatusBadRequest, "Upload size does not match")
+		return
+	}
+
+	delete(f.sessions, r.URL.Query().Get("upload_id"))
+
+	f.createObject(w, session)
+}
+
+// uploadMultipart handles files that fit in a single chunk, which are sent
+// along with their metadata in a single request
+func (f *fakeGCS) uploadMultipart(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid Content-Type")
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := mr.NextPart()
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid multipart body")
+		return
+	}
+
+	var session fakeGCSSession
+	if err := f.decodeResource(r, part, &session); err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid object resource")
+		return
+	}
+
+	part, err = mr.NextPart()
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid multipart body")
+		return
+	}
+
+	session.data, err = io.ReadAll(part)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "Invalid multipart body")
+		return
+	}
+
+	f.chunks++
+	f.createObject(w, &session)
+}
+
+func (f *fakeGCS) decodeResource(req *http.Request, r io.Reader, session *fakeGCSSession) error {
+	var body struct {
+		Name        string            `json:"name"`
+		ContentType string            `json:"contentType"`
+		Metadata    map[string]string `json:"metadata"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return err
+	}
+
+	if body.Name == "" {
+		return errors.New("object name is required")
+	}
+
+	session.name = body.Name
+	session.contentType = body.ContentType
+	session.metadata = body.Metadata
+	session.ifGenerationMatch = req.URL.Query().Get("ifGenerationMatch")
+
+	if hook := f.beforeUpload; hook != nil {
+		hook()
+	}
+
+	return nil
+}
+
+func (f *fakeGCS) createObject(w http.ResponseWriter, session *fakeGCSSession) {
+	if session.ifGenerationMatch != "" &&
+		session.ifGenerationMatch != strconv.FormatInt(f.objects[session.name].generation, 10) {
+		f.writeError(w, http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold.")
+		return
+	}
+
+	f.generation++
+
+	object := fakeGCSObject{
+		data:        session.data,
+		contentType: session.contentType,
+		metadata:    session.metadata,
+		generation:  f.generation,
+		updated:     time.Now().UTC(),
+	}
+
+	if object.contentType == "" {
+		object.contentType = "application/octet-stream"
+	}
+
+	f.objects[session.name] = object
+
+	f.writeJSON(w, http.StatusOK, f.objectResource(session.name, object))
+}
+
+func (f *fakeGCS) object(w http.ResponseWriter, r *http.Request, name string) {
+	object, ok := f.objects[name]
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "No such object: "+f.bucket+"/"+name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodGet:
+		if r.URL.Query().Get("alt") != "media" {
+			f.writeJSON(w, http.StatusOK, f.objectResource(name, object))
+			return
+		}
+
+		if generation := r.URL.Query().Get("generation"); generation != "" &&
+			generation != strconv.FormatInt(object.generation, 10) {
+			f.writeError(w, http.StatusNotFound, "No such object: "+f.bucket+"/"+name)
+			return
+		}
+
+		data, contentRange, err := fakeRange(r.Header.Get("Range"), object.data)
+		if err != nil {
+			f.writeError(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+			return
+		}
+
+		w.Header().Set("Content-Type", object.contentType)
+
+		if contentRange != "" {
+			w.Header().Set("Content-Range", contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+		}
+
+		_, _ = w.Write(data)
+
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (f *fakeGCS) objectResource(name string, object fakeGCSObject) map[string]any {
+	sum := md5.Sum(object.data)
+
+	return map[string]any{
+		"name":        name,
+		"bucket":      f.bucket,
+		"size":        strconv.Itoa(len(object.data)),
+		"contentType": object.contentType,
+		"updated":     object.updated,
+		"generation":  strconv.FormatInt(object.generation, 10),
+		"etag":        base64.StdEncoding.EncodeToString(sum[:]),
+		"metadata":    object.metadata,
+	}
+}
+
+func (f *fakeGCS) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeGCS) writeError(w http.ResponseWriter, status int, message string) {
+	f.writeJSON(w, status, map[string]any{
+		"error": map[string]any{"code": status, "message": message},
+	})
+}
@@ -0,0 +1,475 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type fakeS3Object struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+func (o fakeS3Object) etag() string {
+	sum := md5.Sum(o.data)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+}
+
+type fakeS3Upload struct {
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int][]byte
+}
+
+// fakeS3 is an in-process implementation of the subset of the S3 api
+// used by S3Store. It only supports path style requests
+type fakeS3 struct {
+	mu sync.Mutex
+
+	bucket  string
+	objects map[string]fakeS3Object
+	uploads map[string]*fakeS3Upload
+
+	nextUploadID int
+
+	// the part number that will be rejected, 0 means all parts are accepted
+	failPart int
+
+	putObjectCalls int
+	completed      int
+	aborted        int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *s3.Client) {
+	t.Helper()
+
+	fake := &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string]fakeS3Object),
+		uploads: make(map[string]*fakeS3Upload),
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("gulter", "gulter", ""),
+	})
+
+	return fake, client
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && query.Has("location"):
+		f.writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			Value   string   `xml:",chardata"`
+		}{Value: "us-west-2"})
+
+	case r.Method == http.MethodPost && key == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"):
+		f.postObject(w, r)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.createMultipartUpload(w, r, key)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		f.uploadPart(w, r, query)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeMultipartUpload(w, r, key, query.Get("uploadId"))
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		if _, ok := f.uploads[query.Get("uploadId")]; !ok {
+			f.writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		f.putObjectCalls++
+
+		obj := fakeS3Object{
+			data:         data,
+			contentType:  r.Header.Get("Content-Type"),
+			metadata:     metadataFromHeaders(r.Header),
+			lastModified: time.Now(),
+		}
+
+		f.objects[key] = obj
+		w.Header().Set("ETag", obj.etag())
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		for k, v := range obj.metadata {
+			w.Header().Set("x-amz-meta-"+k, v)
+		}
+
+		data, contentRange, err := fakeRange(r.Header.Get("Range"), obj.data)
+		if err != nil {
+			f.writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+
+		status := http.StatusOK
+		if contentRange != "" {
+			w.Header().Set("Content-Range", contentRange)
+			status = http.StatusPartialContent
+		}
+
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", obj.etag())
+		w.WriteHeader(status)
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) createMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	f.nextUploadID++
+
+	id := strconv.Itoa(f.nextUploadID)
+
+	f.uploads[id] = &fakeS3Upload{
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		metadata:    metadataFromHeaders(r.Header),
+		parts:       make(map[int][]byte),
+	}
+
+	f.writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: f.bucket, Key: key, UploadId: id})
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, query map[string][]string) {
+	upload, ok := f.uploads[query["uploadId"][0]]
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	partNumber, err := strconv.Atoi(query["partNumber"][0])
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	if partNumber == f.failPart {
+		f.writeError(w, http.StatusBadRequest, "InvalidPart")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	upload.parts[partNumber] = data
+
+	w.Header().Set("ETag", fakeS3Object{data: data}.etag())
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeS3) completeMultipartUpload(w http.ResponseWriter, r *http.Request, key, id string) {
+	upload, ok := f.uploads[id]
+	if !ok {
+		f.writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var body struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+
+	if err := xml.NewDecoder(r.Body).Decode(&body); err != nil {
+		f.writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	if !sort.SliceIsSorted(body.Parts, func(i, j int) bool {
+		return body.Parts[i].PartNumber < body.Parts[j].PartNumber
+	}) {
+		f.writeError(w, http.StatusBadRequest, "InvalidPartOrder")
+		return
+	}
+
+	var data []byte
+
+	for _, part := range body.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok {
+			f.writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+
+		data = append(data, partData...)
+	}
+
+	f.objects[key] = fakeS3Object{
+		data:         data,
+		contentType:  upload.contentType,
+		metadata:     upload.metadata,
+		lastModified: time.Now(),
+	}
+
+	delete(f.uploads, id)
+	f.completed++
+
+	f.writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: f.bucket, Key: key, ETag: f.objects[key].etag()})
+}
+
+// postObject handles uploads with a presigned POST policy. Only the
+// conditions generated by S3Store.PresignPost are supported
+func (f *fakeS3) postObject(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "MalformedPOSTRequest")
+		return
+	}
+
+	fields := make(map[string]string)
+
+	var data []byte
+	var fileName string
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "MalformedPOSTRequest")
+			return
+		}
+
+		b, err := io.ReadAll(part)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		// S3 ignores every field after the file
+		if part.FormName() == "file" {
+			data = b
+			fileName = part.FileName()
+			break
+		}
+
+		fields[part.FormName()] = string(b)
+	}
+
+	credential := strings.Split(fields["x-amz-credential"], "/")
+	if len(credential) != 5 {
+		f.writeError(w, http.StatusForbidden, "InvalidAccessKeyId")
+		return
+	}
+
+	signature := hex.EncodeToString(
+		hmacSHA256(postSigningKey("gulter", credential[1], credential[2]), fields["policy"]))
+	if signature != fields["x-amz-signature"] {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	fields["key"] = strings.ReplaceAll(fields["key"], "${filename}", fileName)
+	fields["bucket"] = f.bucket
+
+	policyJSON, err := base64.StdEncoding.DecodeString(fields["policy"])
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "InvalidPolicyDocument")
+		return
+	}
+
+	var policy struct {
+		Expiration time.Time `json:"expiration"`
+		Conditions []any     `json:"conditions"`
+	}
+
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		f.writeError(w, http.StatusBadRequest, "InvalidPolicyDocument")
+		return
+	}
+
+	if time.Now().After(policy.Expiration) {
+		f.writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	for _, condition := range policy.Conditions {
+		var ok bool
+
+		switch c := condition.(type) {
+		case map[string]any:
+			for k, v := range c {
+				ok = fields[k] == v
+			}
+
+		case []any:
+			switch c[0] {
+			case "eq":
+				ok = fields[strings.TrimPrefix(c[1].(string), "$")] == c[2]
+			case "starts-with":
+				ok = strings.HasPrefix(fields[strings.TrimPrefix(c[1].(string), "$")], c[2].(string))
+			case "content-length-range":
+				size := float64(len(data))
+				ok = size >= c[1].(float64) && size <= c[2].(float64)
+			}
+		}
+
+		if !ok {
+			f.writeError(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+	}
+
+	f.objects[fields["key"]] = fakeS3Object{
+		data:         data,
+		contentType:  fields["Content-Type"],
+		metadata:     map[string]string{},
+		lastModified: time.Now(),
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeS3) writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func (f *fakeS3) object(key string) (fakeS3Object, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj, ok := f.objects[key]
+	return obj, ok
+}
+
+// errFakeInvalidRange is returned by fakeRange if the range starts after the
+// end of the data
+var errFakeInvalidRange = errors.New("invalid range")
+
+// fakeRange returns the part of data requested by a Range header of the
+// bytes=start-end form along with its Content-Range. All of data is returned
+// without a Content-Range if no range was requested. Shared by the fakes
+func fakeRange(header string, data []byte) ([]byte, string, error) {
+	if header == "" {
+		return data, "", nil
+	}
+
+	var start, end int
+	if _, err := fmt.Sscanf(header, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, "", err
+	}
+
+	if start >= len(data) {
+		return nil, "", errFakeInvalidRange
+	}
+
+	end = min(end, len(data)-1)
+
+	return data[start : end+1], fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)), nil
+}
+
+func metadataFromHeaders(h http.Header) map[string]string {
+	metadata := make(map[string]string)
+
+	for k := range h {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok {
+			metadata[name] = h.Get(k)
+		}
+	}
+
+	return metadata
+}
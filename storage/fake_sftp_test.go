@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSFTP is an in-process SSH server with an SFTP subsystem. Files are
+// stored in a temporary folder
+type fakeSFTP struct {
+	mu sync.Mutex
+
+	addr    string
+	hostKey ssh.PublicKey
+	dir     string
+
+	// support the posix-rename@openssh.com extension
+	posixRename bool
+
+	conns  []net.Conn
+	logins int
+}
+
+type fakeSFTPCredentials struct {
+	password   string
+	privateKey []byte
+}
+
+func newSFTPTestKey(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, pem.EncodeToMemory(block)
+}
+
+func newFakeSFTP(t *testing.T, posixRename bool) (*fakeSFTP, fakeSFTPCredentials) {
+	t.Helper()
+
+	hostKey, _ := newSFTPTestKey(t)
+	userKey, privateKey := newSFTPTestKey(t)
+
+	creds := fakeSFTPCredentials{password: "gulter", privateKey: privateKey}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "gulter" && string(password) == creds.password {
+				return nil, nil
+			}
+
+			return nil, errors.New("invalid password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "gulter" && bytes.Equal(key.Marshal(), userKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+
+			return nil, errors.New("invalid key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeSFTP{
+		addr:        listener.Addr().String(),
+		hostKey:     hostKey.PublicKey(),
+		dir:         t.TempDir(),
+		posixRename: posixRename,
+	}
+
+	root, err := os.OpenRoot(fake.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+		fake.dropConnections()
+		wg.Wait()
+		_ = root.Close()
+	})
+
+	wg.Go(func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			fake.mu.Lock()
+			fake.conns = append(fake.conns, conn)
+			fake.mu.Unlock()
+
+			wg.Go(func() { fake.serveConn(conn, config, root) })
+		}
+	})
+
+	return fake, creds
+}
+
+func newFakeSFTPStore(t *testing.T, opts SFTPOptions) (*fakeSFTP, *SFTP) {
+	t.Helper()
+
+	fake, creds := newFakeSFTP(t, true)
+
+	opts.Addr = fake.addr
+	opts.User = "gulter"
+	opts.Password = creds.password
+	opts.HostKey = fake.hostKey
+
+	store, err := NewSFTPStorage(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, store
+}
+
+func (f *fakeSFTP) loginCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.logins
+}
+
+// dropConnections closes every connection as if the server restarted
+func (f *fakeSFTP) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range f.conns {
+		_ = conn.Close()
+	}
+
+	f.conns = nil
+}
+
+func (f *fakeSFTP) serveConn(conn net.Conn, config *ssh.ServerConfig, root *os.Root) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.logins++
+	f.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+
+				if ok {
+					go func() {
+						defer channel.Close()
+
+						handlers := &fakeSFTPHandlers{fake: f, root: root}
+
+						server := sftp.NewRequestServer(channel, sftp.Handlers{
+							FileGet:  handlers,
+							FilePut:  handlers,
+							FileCmd:  handlers,
+							FileList: handlers,
+						})
+
+						_ = server.Serve()
+						_ = server.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+// fakeSFTPHandlers serves the requests of a session from the folder of
+// the server
+type fakeSFTPHandlers struct {
+	fake *fakeSFTP
+	root *os.Root
+}
+
+// name maps the paths sent by the client to the folder of the server
+func (h *fakeSFTPHandlers) name(p string) string {
+	name := strings.TrimPrefix(p, "/")
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
+
+func (h *fakeSFTPHandlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	return h.root.Open(h.name(r.Filepath))
+}
+
+func (h *fakeSFTPHandlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	pflags := r.Pflags()
+
+	flag := os.O_WRONLY
+	if pflags.Read {
+		flag = os.O_RDWR
+	}
+
+	if pflags.Creat {
+		flag |= os.O_CREATE
+	}
+
+	if pflags.Trunc {
+		flag |= os.O_TRUNC
+	}
+
+	if pflags.Excl {
+		flag |= os.O_EXCL
+	}
+
+	return h.root.OpenFile(h.name(r.Filepath), flag, 0o600)
+}
+
+func (h *fakeSFTPHandlers) Filecmd(r *sftp.Request) error {
+	name := h.name(r.Filepath)
+
+	switch r.Method {
+	case "Setstat":
+		if r.AttrFlags().Permissions {
+			return h.root.Chmod(name, r.Attributes().FileMode().Perm())
+		}
+
+		return nil
+
+	case "Mkdir":
+		return h.root.Mkdir(name, 0o700)
+
+	case "Remove":
+		return h.root.Remove(name)
+
+	case "Rmdir":
+		return h.root.Remove(name)
+
+	case "Rename":
+		// like OpenSSH, a plain rename does not replace existing files
+		if _, err := h.root.Stat(h.name(r.Target)); err == nil {
+			return fs.ErrExist
+		}
+
+		return h.root.Rename(name, h.name(r.Target))
+
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+func (h *fakeSFTPHandlers) PosixRename(r *sftp.Request) error {
+	if !h.fake.posixRename {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+
+	return h.root.Rename(h.name(r.Filepath), h.name(r.Target))
+}
+
+func (h *fakeSFTPHandlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if r.Method != "Stat" {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+
+	info, err := h.root.Stat(h.name(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+
+	return fakeSFTPLister{info}, nil
+}
+
+type fakeSFTPLister []os.FileInfo
+
+func (l fakeSFTPLister) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
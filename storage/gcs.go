@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/adelowo/gulter"
+	"github.com/ayinke-llc/hermes"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+
+	// GCS requires every chunk of a resumable upload but the last one to be
+	// a multiple of 256KB
+	gcsChunkAlignment   = 256 * 1024
+	defaultGCSChunkSize = 16 * 1024 * 1024
+)
+
+type GCSOptions struct {
+	Bucket string
+
+	// Endpoint of the GCS json api, passed to the client with
+	// option.WithEndpoint. For example http://localhost:4443/storage/v1/ for
+	// the emulator. The client also uses the STORAGE_EMULATOR_HOST
+	// environment variable if set
+	Endpoint string
+
+	// Files are streamed to GCS in chunks of this size with a resumable
+	// upload. Rounded up to a multiple of 256KB. Defaults to 16MB
+	ChunkSize int
+
+	// The service account email and either its PEM encoded private key or
+	// a func that signs with it, like the IAM signBlob api, used to sign
+	// URLs when PathOptions.IsSecure is true. URLs cannot be signed and
+	// downloads are not redirected to GCS unless they are provided
+	GoogleAccessID string
+	PrivateKey     []byte
+	SignBytes      func(b []byte) ([]byte, error)
+
+	// If provided, Path returns PublicURL/key for files instead of the
+	// public GCS URL. Useful if the bucket is behind a CDN
+	PublicURL string
+
+	// Layout decides the key files are stored under. Defaults to FlatLayout
+	Layout LayoutFunc
+}
+
+func (o GCSOptions) withDefaults() GCSOptions {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = defaultGCSChunkSize
+	}
+
+	if rem := o.ChunkSize % gcsChunkAlignment; rem != 0 {
+		o.ChunkSize += gcsChunkAlignment - rem
+	}
+
+	if hermes.IsStringEmpty(o.PublicURL) {
+		o.PublicURL = defaultGCSEndpoint + "/" + o.Bucket
+	}
+
+	o.PublicURL = strings.TrimSuffix(o.PublicURL, "/")
+
+	if o.Layout == nil {
+		o.Layout = FlatLayout
+	}
+
+	return o
+}
+
+type GCSStore struct {
+	client *gcs.Client
+	bucket *gcs.BucketHandle
+	opts   GCSOptions
+
+	// set if the client was created by NewGCS and has to be closed
+	ownsClient bool
+}
+
+// NewGCS creates a GCS client with the application default credentials.
+// clientOpts are passed to the client as is
+func NewGCS(ctx context.Context, opts GCSOptions,
+	clientOpts ...option.ClientOption,
+) (*GCSStore, error) {
+	if hermes.IsStringEmpty(opts.Bucket) {
+		return nil, errors.New("please provide a valid gcs bucket")
+	}
+
+	if !hermes.IsStringEmpty(opts.Endpoint) {
+		clientOpts = append(clientOpts, option.WithEndpoint(opts.Endpoint))
+	}
+
+	client, err := gcs.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewGCSFromClient(client, opts)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	store.ownsClient = true
+	return store, nil
+}
+
+func NewGCSFromClient(client *gcs.Client, opts GCSOptions) (*GCSStore, error) {
+	if client == nil {
+		return nil, errors.New("please provide a valid gcs client")
+	}
+
+	if hermes.IsStringEmpty(opts.Bucket) {
+		return nil, errors.New("please provide a valid gcs bucket")
+	}
+
+	hasSigner := len(opts.PrivateKey) > 0 || opts.SignBytes != nil
+	if hasSigner && hermes.IsStringEmpty(opts.GoogleAccessID) {
+		return nil, errors.New("please provide the service account that signs urls")
+	}
+
+	store := &GCSStore{
+		client: client,
+		bucket: client.Bucket(opts.Bucket),
+		opts:   opts.withDefaults(),
+	}
+
+	// signing with a private key does not leave the process, so an invalid
+	// key is reported right away
+	if len(opts.PrivateKey) > 0 {
+		if _, err := store.signedURL("gulter", time.Minute); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (g *GCSStore) Close() error {
+	if g.ownsClient {
+		return g.client.Close()
+	}
+
+	return nil
+}
+
+func (g *GCSStore) canSign() bool {
+	return !hermes.IsStringEmpty(g.opts.GoogleAccessID) &&
+		(len(g.opts.PrivateKey) > 0 || g.opts.SignBytes != nil)
+}
+
+// Upload streams the file to GCS with a resumable upload so only a single
+// chunk is held in memory at a time
+func (g *GCSStore) Upload(ctx context.Context, r io.Reader,
+	opts *gulter.UploadFileOptions,
+) (*gulter.UploadedFileMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := g.opts.Layout(opts.FileName)
+
+	// the client only retries uploads with a precondition, so the upload is
+	// made to only replace the generation of the file that exists now. A
+	// concurrent upload of the same key then fails instead of being
+	// overwritten by a retry
+	conds := gcs.Conditions{DoesNotExist: true}
+
+	attrs, err := g.bucket.Object(key).Attrs(ctx)
+	switch {
+	case err == nil:
+		conds = gcs.Conditions{GenerationMatch: attrs.Generation}
+	case !errors.Is(err, gcs.ErrObjectNotExist):
+		return nil, err
+	}
+
+	// cancelling the context is the only way to abort the upload, otherwise
+	// closing the writer would create the object with what was read so far
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := g.bucket.Object(key).If(conds).NewWriter(ctx)
+	w.ChunkSize = g.opts.ChunkSize
+	w.ContentType = opts.ContentType
+	w.Metadata = opts.Metadata
+
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &gulter.UploadedFileMetadata{
+		FolderDestination: g.opts.Bucket,
+		Size:              w.Attrs().Size,
+		Key:               key,
+	}, nil
+}
+
+// RedirectDownloads makes ServeFile redirect clients to a signed URL so
+// files are downloaded from GCS directly if the client can sign URLs
+func (g *GCSStore) RedirectDownloads() bool { return g.canSign() }
+
+func (g *GCSStore) Path(_ context.Context, opts gulter.PathOptions) (string, error) {
+	if !opts.IsSecure {
+		return g.opts.PublicURL + "/" + gcsEscape(opts.Key), nil
+	}
+
+	if !g.canSign() {
+		return "", errors.New("gulter: a service account and private key or SignBytes are required to sign gcs urls")
+	}
+
+	expiration := opts.ExpirationTime
+	if expiration <= 0 {
+		expiration = defaultSignedURLExpiration
+	}
+
+	return g.signedURL(opts.Key, expiration)
+}
+
+func (g *GCSStore) signedURL(key string, expiration time.Duration) (string, error) {
+	return g.bucket.SignedURL(key, &gcs.SignedURLOptions{
+		GoogleAccessID: g.opts.GoogleAccessID,
+		PrivateKey:     g.opts.PrivateKey,
+		SignBytes:      g.opts.SignBytes,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(expiration),
+		Scheme:         gcs.SigningSchemeV4,
+		Insecure:       strings.HasPrefix(g.opts.Endpoint, "http://"),
+	})
+}
+
+func (g *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	attrs, err := g.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, nil, gcsError(err)
+	}
+
+	// pin the download to the generation we have the metadata of in case
+	// the file is replaced in between
+	rc, err := g.bucket.Object(key).Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, nil, gcsError(err)
+	}
+
+	return rc, gcsFileInfo(attrs), nil
+}
+
+// GetRange retrieves part of a file with a ranged read
+func (g *GCSStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := g.bucket.Object(key).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		// the range starts after the end of the file
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusRequestedRangeNotSatisfiable {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+
+		return nil, gcsError(err)
+	}
+
+	return rc, nil
+}
+
+func (g *GCSStore) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	attrs, err := g.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+
+	return gcsFileInfo(attrs), nil
+}
+
+func (g *GCSStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := g.Stat(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, gulter.ErrFileNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (g *GCSStore) Delete(ctx context.Context, key string) error {
+	err := g.bucket.Object(key).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func gcsFileInfo(attrs *gcs.ObjectAttrs) *gulter.FileInfo {
+	info := &gulter.FileInfo{
+		Key:          attrs.Name,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		LastModified: attrs.Updated,
+		Metadata:     attrs.Metadata,
+
+		FolderDestination: attrs.Bucket,
+	}
+
+	if attrs.Etag != "" {
+		info.ETag = fmt.Sprintf("%q", attrs.Etag)
+	}
+
+	return info
+}
+
+// gcsError makes errors for objects that do not exist wrap
+// gulter.ErrFileNotFound
+func gcsError(err error) error {
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	return err
+}
+
+// gcsEscape percent encodes everything but the unreserved characters of
+// RFC 3986 and slashes
+func gcsEscape(s string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
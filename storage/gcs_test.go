@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func gcsTestKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+}
+
+func TestNewGCS(t *testing.T) {
+	_, privateKey := gcsTestKey(t)
+
+	tt := []struct {
+		name     string
+		opts     GCSOptions
+		hasError bool
+		canSign  bool
+	}{
+		{
+			name:     "no bucket",
+			opts:     GCSOptions{},
+			hasError: true,
+		},
+		{
+			name:     "private key without service account",
+			opts:     GCSOptions{Bucket: "gulter", PrivateKey: privateKey},
+			hasError: true,
+		},
+		{
+			name: "no signing credentials",
+			opts: GCSOptions{Bucket: "gulter"},
+		},
+		{
+			name: "signing with SignBytes",
+			opts: GCSOptions{
+				Bucket:         "gulter",
+				GoogleAccessID: "gulter@gulter.iam.gserviceaccount.com",
+				SignBytes: func(b []byte) ([]byte, error) {
+					return nil, errors.New("SignBytes must not be called")
+				},
+			},
+			canSign: true,
+		},
+		{
+			name: "invalid private key",
+			opts: GCSOptions{
+				Bucket:         "gulter",
+				GoogleAccessID: "gulter@gulter.iam.gserviceaccount.com",
+				PrivateKey:     []byte("gulter"),
+			},
+			hasError: true,
+		},
+		{
+			name: "signing enabled",
+			opts: GCSOptions{
+				Bucket:         "gulter",
+				GoogleAccessID: "gulter@gulter.iam.gserviceaccount.com",
+				PrivateKey:     privateKey,
+			},
+			canSign: true,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			store, err := NewGCS(context.Background(), v.opts, option.WithoutAuthentication())
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, v.canSign, store.RedirectDownloads())
+			require.NoError(t, store.Close())
+		})
+	}
+
+	_, err := NewGCSFromClient(nil, GCSOptions{Bucket: "gulter"})
+	require.Error(t, err)
+}
+
+func TestGCSStore_ResumableUpload(t *testing.T) {
+	ctx := context.Background()
+
+	// rounded up to 256KB
+	fake, store := newFakeGCSStore(t, GCSOptions{ChunkSize: 1})
+
+	content := bytes.Repeat([]byte("gulter"), 100*1024)
+
+	// hide the seeker so the file has to be streamed
+	metadata, err := store.Upload(ctx, io.MultiReader(bytes.NewReader(content)), &gulter.UploadFileOptions{
+		FileName:    "folder/gulter.txt",
+		ContentType: "text/plain",
+		Metadata: map[string]string{
+			gulter.MetadataOriginalName: "notes.txt",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "folder/gulter.txt", metadata.Key)
+	require.Equal(t, int64(len(content)), metadata.Size)
+	require.Equal(t, 3, fake.chunks)
+
+	rc, info, err := store.Get(ctx, metadata.Key)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	require.True(t, bytes.Equal(content, b))
+	require.Equal(t, "text/plain", info.ContentType)
+	require.Equal(t, "notes.txt", info.Metadata[gulter.MetadataOriginalName])
+
+	// files that are an exact multiple of the chunk size
+	_, err = store.Upload(ctx, bytes.NewReader(make([]byte, gcsChunkAlignment*2)), &gulter.UploadFileOptions{
+		FileName: "aligned.bin",
+	})
+	require.NoError(t, err)
+
+	info, err = store.Stat(ctx, "aligned.bin")
+	require.NoError(t, err)
+	require.Equal(t, int64(gcsChunkAlignment*2), info.Size)
+}
+
+func TestGCSStore_UploadRetries(t *testing.T) {
+	tt := []struct {
+		name string
+		size int
+	}{
+		{
+			name: "single chunk",
+			size: 1024,
+		},
+		{
+			name: "several chunks",
+			size: gcsChunkAlignment + 1024,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake, store := newFakeGCSStore(t, GCSOptions{ChunkSize: gcsChunkAlignment})
+			fake.failures = 1
+
+			content := bytes.Repeat([]byte("g"), v.size)
+
+			metadata, err := store.Upload(ctx, io.MultiReader(bytes.NewReader(content)), &gulter.UploadFileOptions{
+				FileName: "gulter.txt",
+			})
+			require.NoError(t, err)
+			require.Equal(t, int64(v.size), metadata.Size)
+			require.Zero(t, fake.failures)
+
+			rc, _, err := store.Get(ctx, metadata.Key)
+			require.NoError(t, err)
+
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			require.True(t, bytes.Equal(content, b))
+		})
+	}
+}
+
+func TestGCSStore_ConcurrentUpload(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeGCSStore(t, GCSOptions{})
+
+	_, err := store.Upload(ctx, strings.NewReader("first"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+
+	// another upload replaces the file while this one is in progress
+	fake.beforeUpload = func() {
+		fake.generation++
+
+		object := fake.objects["gulter.txt"]
+		object.data = []byte("concurrent")
+		object.generation = fake.generation
+		fake.objects["gulter.txt"] = object
+	}
+
+	_, err = store.Upload(ctx, strings.NewReader("second"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.Error(t, err)
+	require.Equal(t, "concurrent", string(fake.objects["gulter.txt"].data))
+}
+
+func TestGCSStore_FailedUpload(t *testing.T) {
+	fake, store := newFakeGCSStore(t, GCSOptions{ChunkSize: gcsChunkAlignment})
+
+	errRead := errors.New("connection reset")
+
+	r := io.MultiReader(bytes.NewReader(make([]byte, gcsChunkAlignment*2)), iotestErrReader{errRead})
+
+	_, err := store.Upload(context.Background(), r, &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.ErrorIs(t, err, errRead)
+	require.Empty(t, fake.objects)
+}
+
+type iotestErrReader struct{ err error }
+
+func (r iotestErrReader) Read(_ []byte) (int, error) { return 0, r.err }
+
+func TestGCSStore_Path(t *testing.T) {
+	ctx := context.Background()
+
+	_, store := newFakeGCSStore(t, GCSOptions{})
+
+	p, err := store.Path(ctx, gulter.PathOptions{Key: "folder/hello gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "https://storage.googleapis.com/gulter/folder/hello%20gulter.txt", p)
+
+	_, err = store.Path(ctx, gulter.PathOptions{Key: "gulter.txt", IsSecure: true})
+	require.Error(t, err)
+	require.False(t, store.RedirectDownloads())
+
+	_, store = newFakeGCSStore(t, GCSOptions{PublicURL: "https://cdn.example.com/"})
+
+	p, err = store.Path(ctx, gulter.PathOptions{Key: "gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "https://cdn.example.com/gulter.txt", p)
+}
+
+func TestGCSStore_SignedURL(t *testing.T) {
+	_, privateKey := gcsTestKey(t)
+
+	store, err := NewGCS(context.Background(), GCSOptions{
+		Bucket:         "gulter",
+		GoogleAccessID: "gulter@gulter.iam.gserviceaccount.com",
+		PrivateKey:     privateKey,
+	}, option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	signed, err := store.Path(context.Background(), gulter.PathOptions{
+		Key:            "folder/hello gulter.txt",
+		IsSecure:       true,
+		ExpirationTime: time.Hour,
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	require.Equal(t, "https", u.Scheme)
+	require.Equal(t, "storage.googleapis.com", u.Host)
+	require.Equal(t, "/gulter/folder/hello%20gulter.txt", u.EscapedPath())
+
+	query := u.Query()
+	require.Equal(t, "GOOG4-RSA-SHA256", query.Get("X-Goog-Algorithm"))
+	require.True(t, strings.HasPrefix(query.Get("X-Goog-Credential"), "gulter@gulter.iam.gserviceaccount.com/"))
+	require.Contains(t, []string{"3599", "3600"}, query.Get("X-Goog-Expires"))
+	require.NotEmpty(t, query.Get("X-Goog-Signature"))
+
+	// GCS rejects V4 signed URLs that are valid for longer than 7 days
+	_, err = store.Path(context.Background(), gulter.PathOptions{
+		Key:            "gulter.txt",
+		IsSecure:       true,
+		ExpirationTime: 8 * 24 * time.Hour,
+	})
+	require.Error(t, err)
+}
+
+func TestGCSStore_EmulatorHost(t *testing.T) {
+	fake := newFakeGCS(t, "gulter")
+
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(fake.server.URL, "http://"))
+
+	store, err := NewGCS(context.Background(), GCSOptions{Bucket: "gulter"})
+	require.NoError(t, err)
+
+	_, err = store.Upload(context.Background(), strings.NewReader("gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+	require.Contains(t, fake.objects, "gulter.txt")
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"time"
+)
+
+// LayoutFunc decides where a file is stored by turning its name into the key
+// it is stored under. Keys use forward slashes to separate folders, so the
+// same layout can be used with Disk and object stores like S3
+type LayoutFunc func(fileName string) string
+
+// FlatLayout stores every file at the root of the storage
+func FlatLayout(fileName string) string {
+	return fileName
+}
+
+// HashLayout spreads files across nested folders named after the sha256 hash
+// of their name so no single folder ends up with too many files.
+// With 2 levels of 2 characters, a file is stored as ab/cd/name.
+// Defaults to 2 levels and 2 characters if either is not provided
+func HashLayout(levels, width int) LayoutFunc {
+	if levels <= 0 {
+		levels = 2
+	}
+
+	if width <= 0 {
+		width = 2
+	}
+
+	// a sha256 hash has 64 characters
+	if levels*width > sha256.Size*2 {
+		levels = sha256.Size * 2 / width
+	}
+
+	return func(fileName string) string {
+		sum := sha256.Sum256([]byte(fileName))
+		hash := hex.EncodeToString(sum[:])
+
+		parts := make([]string, 0, levels+1)
+		for i := range levels {
+			parts = append(parts, hash[i*width:(i+1)*width])
+		}
+
+		return strings.Join(append(parts, fileName), "/")
+	}
+}
+
+// DateLayout stores files in folders named after the UTC date they were
+// uploaded on, like 2026/10/17/name
+func DateLayout() LayoutFunc {
+	return dateLayout(time.Now)
+}
+
+func dateLayout(now func() time.Time) LayoutFunc {
+	return func(fileName string) string {
+		return path.Join(now().UTC().Format("2006/01/02"), fileName)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+	tt := []struct {
+		name     string
+		layout   LayoutFunc
+		expected string
+	}{
+		{
+			name:     "flat",
+			layout:   FlatLayout,
+			expected: "gulter.txt",
+		},
+		{
+			name:     "hash with the default levels",
+			layout:   HashLayout(0, 0),
+			expected: "e3/83/gulter.txt",
+		},
+		{
+			name:     "hash with 3 levels of a single character",
+			layout:   HashLayout(3, 1),
+			expected: "e/3/8/gulter.txt",
+		},
+		{
+			name: "date",
+			layout: dateLayout(func() time.Time {
+				return time.Date(2026, time.October, 17, 23, 0, 0, 0, time.FixedZone("WAT", -3600))
+			}),
+			expected: "2026/10/18/gulter.txt",
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			require.Equal(t, v.expected, v.layout("gulter.txt"))
+		})
+	}
+}
+
+func TestLayout_Disk(t *testing.T) {
+	ctx := context.Background()
+
+	folder := t.TempDir()
+
+	disk, err := NewDiskStorageWithOptions(folder, DiskOptions{Layout: HashLayout(2, 2)})
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	metadata, err := disk.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "e3/83/gulter.txt", metadata.Key)
+	require.Equal(t, filepath.Join(folder, "e3", "83"), metadata.FolderDestination)
+
+	p, err := disk.Path(ctx, gulter.PathOptions{Key: metadata.Key})
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, "hello gulter", string(b))
+}
+
+func TestLayout_S3(t *testing.T) {
+	fake, client := newFakeS3(t, "gulter")
+
+	store, err := NewS3FromClient(client, S3Options{
+		Bucket: "gulter",
+		Layout: HashLayout(2, 2),
+	})
+	require.NoError(t, err)
+
+	metadata, err := store.Upload(context.Background(), strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "gulter.txt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "e3/83/gulter.txt", metadata.Key)
+
+	_, ok := fake.object("e3/83/gulter.txt")
+	require.True(t, ok)
+}
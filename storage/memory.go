@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/ayinke-llc/hermes"
+)
+
+// ErrInjectedFault is returned by Memory when an upload fails on purpose
+var ErrInjectedFault = errors.New("gulter: injected fault")
+
+// MemoryFaults makes Memory fail or slow down on purpose so error paths can
+// be tested without mocks
+type MemoryFaults struct {
+	// FailUpload makes the Nth call to Upload fail, counting from 1.
+	// 0 disables it
+	FailUpload int
+
+	// Err is returned by the failed upload. Defaults to ErrInjectedFault
+	Err error
+
+	// Latency is added to every operation. The operation fails early if
+	// the context is cancelled in the meantime
+	Latency time.Duration
+}
+
+type MemoryOptions struct {
+	// Layout decides the key files are stored under. Defaults to FlatLayout
+	Layout LayoutFunc
+
+	// BaseURL is where DownloadHandler is mounted, like
+	// http://localhost:8080/files. If provided, Path returns HTTP URLs
+	// instead of data: URLs with the content of the file
+	BaseURL string
+
+	Faults MemoryFaults
+}
+
+type memoryFile struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+// Memory keeps files in memory. It is safe for concurrent use and meant for
+// tests and ephemeral data, everything is lost once the process exits
+type Memory struct {
+	mu      sync.RWMutex
+	files   map[string]memoryFile
+	opts    MemoryOptions
+	uploads int
+}
+
+func NewMemoryStorage(opts MemoryOptions) *Memory {
+	if opts.Layout == nil {
+		opts.Layout = FlatLayout
+	}
+
+	return &Memory{
+		files: make(map[string]memoryFile),
+		opts:  opts,
+	}
+}
+
+func (m *Memory) Close() error { return nil }
+
+func (m *Memory) Upload(ctx context.Context, r io.Reader,
+	opts *gulter.UploadFileOptions,
+) (*gulter.UploadedFileMetadata, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.uploads++
+	attempt := m.uploads
+	faults := m.opts.Faults
+	m.mu.Unlock()
+
+	if faults.FailUpload > 0 && attempt == faults.FailUpload {
+		if faults.Err != nil {
+			return nil, faults.Err
+		}
+
+		return nil, ErrInjectedFault
+	}
+
+	// the file is read before the lock is held so slow readers do not
+	// block other operations
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key := m.opts.Layout(opts.FileName)
+
+	m.mu.Lock()
+	m.files[key] = memoryFile{
+		data:         data,
+		contentType:  opts.ContentType,
+		metadata:     maps.Clone(opts.Metadata),
+		lastModified: time.Now(),
+	}
+	m.mu.Unlock()
+
+	return &gulter.UploadedFileMetadata{
+		Key:  key,
+		Size: int64(len(data)),
+	}, nil
+}
+
+// Path returns a data: URL with the content of the file unless
+// MemoryOptions.BaseURL is provided
+func (m *Memory) Path(ctx context.Context, opts gulter.PathOptions) (string, error) {
+	if err := m.wait(ctx); err != nil {
+		return "", err
+	}
+
+	if !hermes.IsStringEmpty(m.opts.BaseURL) {
+		segments := strings.Split(opts.Key, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+
+		return strings.TrimSuffix(m.opts.BaseURL, "/") + "/" + strings.Join(segments, "/"), nil
+	}
+
+	file, err := m.file(opts.Key)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := file.contentType
+	if contentType == "" {
+		contentType = http.DetectContentType(file.data)
+	}
+
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(file.data), nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := m.file(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return readSeekNopCloser{bytes.NewReader(file.data)}, file.info(key), nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	file, err := m.file(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return file.info(key), nil
+}
+
+func (m *Memory) Exists(ctx context.Context, key string) (bool, error) {
+	if err := m.wait(ctx); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.files[key]
+	return ok, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	if err := m.wait(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, key)
+	return nil
+}
+
+// Keys returns the keys of all stored files in lexical order
+func (m *Memory) Keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(m.files))
+}
+
+// Bytes returns a copy of the content of a file
+func (m *Memory) Bytes(key string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.files[key]
+	if !ok {
+		return nil, false
+	}
+
+	return bytes.Clone(file.data), true
+}
+
+// SetFaults replaces the configured faults. Uploads are counted again from
+// this point for MemoryFaults.FailUpload
+func (m *Memory) SetFaults(faults MemoryFaults) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.opts.Faults = faults
+	m.uploads = 0
+}
+
+// Reset removes all files and starts counting uploads from 0 again
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files = make(map[string]memoryFile)
+	m.uploads = 0
+}
+
+// DownloadHandler serves the files of this storage at MemoryOptions.BaseURL
+func (m *Memory) DownloadHandler(opts *gulter.ServeOptions) http.Handler {
+	prefix := "/"
+	if u, err := url.Parse(m.opts.BaseURL); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok || key == "" {
+			gulter.ServeError(w, r, gulter.ErrFileNotFound, opts)
+			return
+		}
+
+		gulter.ServeFile(w, r, m, key, opts)
+	})
+}
+
+func (m *Memory) file(key string) (memoryFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.files[key]
+	if !ok {
+		return memoryFile{}, fmt.Errorf("%s does not exist...%w", key, gulter.ErrFileNotFound)
+	}
+
+	return file, nil
+}
+
+// wait adds the configured latency
+func (m *Memory) wait(ctx context.Context) error {
+	m.mu.RLock()
+	latency := m.opts.Faults.Latency
+	m.mu.RUnlock()
+
+	if latency <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (f memoryFile) info(key string) *gulter.FileInfo {
+	sum := md5.Sum(f.data)
+
+	return &gulter.FileInfo{
+		Key:          key,
+		Size:         int64(len(f.data)),
+		ContentType:  f.contentType,
+		LastModified: f.lastModified,
+		ETag:         fmt.Sprintf(`"%x"`, sum),
+		Metadata:     maps.Clone(f.metadata),
+	}
+}
+
+// readSeekNopCloser lets ServeFile serve range requests from memory
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error { return nil }
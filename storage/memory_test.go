@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_FileLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStorage(MemoryOptions{})
+
+	metadata, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+		Metadata: map[string]string{
+			gulter.MetadataOriginalName: "notes.txt",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "gulter.txt", metadata.Key)
+	require.Equal(t, int64(12), metadata.Size)
+
+	exists, err := store.Exists(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	info, err := store.Stat(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(12), info.Size)
+	require.Equal(t, "text/plain", info.ContentType)
+	require.Equal(t, "notes.txt", info.Metadata[gulter.MetadataOriginalName])
+	require.NotEmpty(t, info.ETag)
+
+	rc, _, err := store.Get(ctx, "gulter.txt")
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "hello gulter", string(b))
+
+	p, err := store.Path(ctx, gulter.PathOptions{Key: "gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "data:text/plain;base64,aGVsbG8gZ3VsdGVy", p)
+
+	require.Equal(t, []string{"gulter.txt"}, store.Keys())
+
+	content, ok := store.Bytes("gulter.txt")
+	require.True(t, ok)
+	require.Equal(t, "hello gulter", string(content))
+
+	require.NoError(t, store.Delete(ctx, "gulter.txt"))
+	require.NoError(t, store.Delete(ctx, "gulter.txt"))
+
+	exists, err = store.Exists(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = store.Stat(ctx, "gulter.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	_, _, err = store.Get(ctx, "gulter.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	_, err = store.Path(ctx, gulter.PathOptions{Key: "gulter.txt"})
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestMemory_DownloadHandler(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStorage(MemoryOptions{
+		BaseURL: "https://example.com/files",
+		Layout:  HashLayout(1, 2),
+	})
+
+	metadata, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "e3/gulter.txt", metadata.Key)
+
+	p, err := store.Path(ctx, gulter.PathOptions{Key: metadata.Key})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/files/e3/gulter.txt", p)
+
+	r := httptest.NewRequest(http.MethodGet, p, nil)
+	r.Header.Set("Range", "bytes=6-")
+
+	w := httptest.NewRecorder()
+	store.DownloadHandler(nil).ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "gulter", w.Body.String())
+
+	w = httptest.NewRecorder()
+	store.DownloadHandler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/e3/other.txt", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMemory_Faults(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStorage(MemoryOptions{
+		Faults: MemoryFaults{FailUpload: 2},
+	})
+
+	upload := func(name string) error {
+		_, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+			FileName: name,
+		})
+		return err
+	}
+
+	require.NoError(t, upload("first.txt"))
+	require.ErrorIs(t, upload("second.txt"), ErrInjectedFault)
+	require.NoError(t, upload("third.txt"))
+	require.Equal(t, []string{"first.txt", "third.txt"}, store.Keys())
+
+	errBucketFull := errors.New("bucket is full")
+
+	store.SetFaults(MemoryFaults{FailUpload: 1, Err: errBucketFull})
+	require.ErrorIs(t, upload("fourth.txt"), errBucketFull)
+
+	store.SetFaults(MemoryFaults{Latency: time.Second})
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err := store.Stat(timeoutCtx, "first.txt")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	store.Reset()
+	require.Empty(t, store.Keys())
+}
+
+func TestMemory_ConcurrentUploads(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStorage(MemoryOptions{})
+
+	var wg sync.WaitGroup
+
+	for i := range 50 {
+		wg.Go(func() {
+			key := strconv.Itoa(i) + ".txt"
+
+			_, err := store.Upload(ctx, strings.NewReader(key), &gulter.UploadFileOptions{
+				FileName: key,
+			})
+			require.NoError(t, err)
+
+			_, err = store.Stat(ctx, key)
+			require.NoError(t, err)
+		})
+	}
+
+	wg.Wait()
+
+	require.Len(t, store.Keys(), 50)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/ayinke-llc/hermes"
 )
 
@@ -27,6 +28,50 @@ type S3Options struct {
 
 	// If enabled, we will use this as the domain path for Path
 	CloudflareDomain string
+
+	// Files larger than this will be uploaded with a multipart upload
+	// Defaults to PartSize
+	MultipartThreshold int64
+
+	// The size of each part of a multipart upload. S3 requires parts
+	// to be at least 5MB. Defaults to 8MB
+	PartSize int64
+
+	// How many parts of a single file can be uploaded at the same time.
+	// Defaults to 4
+	Concurrency int
+
+	// Layout decides the key files are stored under. Defaults to FlatLayout
+	Layout LayoutFunc
+
+	// By default, a multipart upload that fails is aborted so S3 can
+	// remove the parts that were already uploaded. If true, the upload is
+	// left as is and has to be cleaned up by a lifecycle rule or manually
+	LeavePartsOnError bool
+}
+
+func (o S3Options) withDefaults() S3Options {
+	if o.PartSize <= 0 {
+		o.PartSize = defaultS3PartSize
+	}
+
+	if o.PartSize < minS3PartSize {
+		o.PartSize = minS3PartSize
+	}
+
+	if o.MultipartThreshold <= 0 {
+		o.MultipartThreshold = o.PartSize
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultS3Concurrency
+	}
+
+	if o.Layout == nil {
+		o.Layout = FlatLayout
+	}
+
+	return o
 }
 
 type S3Store struct {
@@ -37,6 +82,7 @@ type S3Store struct {
 }
 
 func NewS3FromConfig(cfg aws.Config, opts S3Options) (*S3Store, error) {
+	opts = opts.withDefaults()
 
 	if hermes.IsStringEmpty(opts.Bucket) {
 		return nil, errors.New("please provide a valid s3 bucket")
@@ -59,28 +105,18 @@ func NewS3FromConfig(cfg aws.Config, opts S3Options) (*S3Store, error) {
 }
 
 func NewS3FromEnvironment(opts S3Options) (*S3Store, error) {
-
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return nil, err
 	}
 
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.UsePathStyle = opts.UsePathStyle
-
-		if opts.DebugMode {
-			o.ClientLogMode = aws.LogSigning | aws.LogRequest | aws.LogResponseWithBody
-		}
-	})
-
-	return &S3Store{
-		client: client,
-		opts:   opts,
-	}, nil
+	return NewS3FromConfig(cfg, opts)
 }
 
 func NewS3FromClient(client *s3.Client,
 	opts S3Options) (*S3Store, error) {
+	opts = opts.withDefaults()
+
 	return &S3Store{
 		client,
 		opts,
@@ -94,39 +130,72 @@ func (s *S3Store) Close() error { return nil }
 func (s *S3Store) Upload(ctx context.Context, r io.Reader,
 	opts *gulter.UploadFileOptions,
 ) (*gulter.UploadedFileMetadata, error) {
+	uploadOpts := *opts
+	uploadOpts.FileName = s.opts.Layout(opts.FileName)
+	opts = &uploadOpts
 
-	b := new(bytes.Buffer)
+	var size int64
 
-	r = io.TeeReader(r, b)
+	seeker, ok := r.(io.ReadSeeker)
+	if ok {
+		n, err := seekerSize(seeker)
+		if err != nil {
+			return nil, err
+		}
 
-	n, err := io.Copy(io.Discard, r)
-	if err != nil {
-		return nil, err
+		if n > s.opts.MultipartThreshold {
+			return s.uploadMultipart(ctx, seeker, opts, n)
+		}
+
+		size = n
+	} else {
+		// we do not know the size of the file, so we read up to the
+		// threshold. If there is still more data after that, it is
+		// uploaded in parts so we never hold the entire file in memory
+		b := new(bytes.Buffer)
+
+		n, err := io.CopyN(b, r, s.opts.MultipartThreshold+1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if n > s.opts.MultipartThreshold {
+			return s.uploadMultipart(ctx, io.MultiReader(b, r), opts, -1)
+		}
+
+		seeker = bytes.NewReader(b.Bytes())
+		size = n
 	}
 
-	seeker, err := gulter.ReaderToSeeker(b)
-	if err != nil {
-		return nil, err
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Metadata:      opts.Metadata,
+		Key:           aws.String(opts.FileName),
+		ACL:           s.opts.ACL,
+		Body:          seeker,
+		ContentLength: aws.Int64(size),
 	}
 
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:   aws.String(s.bucket),
-		Metadata: opts.Metadata,
-		Key:      aws.String(opts.FileName),
-		ACL:      s.opts.ACL,
-		Body:     seeker,
-	})
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	_, err := s.client.PutObject(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 
 	return &gulter.UploadedFileMetadata{
 		FolderDestination: s.bucket,
-		Size:              n,
+		Size:              size,
 		Key:               opts.FileName,
 	}, nil
 }
 
+// RedirectDownloads makes ServeFile redirect clients to a presigned URL so
+// files are downloaded from S3 directly
+func (s *S3Store) RedirectDownloads() bool { return true }
+
 func (s *S3Store) Path(ctx context.Context, opts gulter.PathOptions) (string, error) {
 
 	if !opts.IsSecure {
@@ -151,15 +220,152 @@ func (s *S3Store) Path(ctx context.Context, opts gulter.PathOptions) (string, er
 		return url, nil
 	}
 
+	expiration := opts.ExpirationTime
+	if expiration <= 0 {
+		expiration = defaultSignedURLExpiration
+	}
+
 	presignClient := s3.NewPresignClient(s.client)
 
 	presignedReq, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: hermes.Ref(s.bucket),
 		Key:    hermes.Ref(opts.Key),
-	}, s3.WithPresignExpires(opts.ExpirationTime))
+	}, s3.WithPresignExpires(expiration))
 	if err != nil {
 		return "", err
 	}
 
 	return presignedReq.URL, nil
 }
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+
+	return resp.Body, &gulter.FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ContentType:  aws.ToString(resp.ContentType),
+		LastModified: aws.ToTime(resp.LastModified),
+		ETag:         aws.ToString(resp.ETag),
+		Metadata:     resp.Metadata,
+
+		FolderDestination: s.bucket,
+	}, nil
+}
+
+// GetRange retrieves part of a file with a ranged GET request
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		// the range starts after the end of the file
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+
+		return nil, s3Error(err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return &gulter.FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ContentType:  aws.ToString(resp.ContentType),
+		LastModified: aws.ToTime(resp.LastModified),
+		ETag:         aws.ToString(resp.ETag),
+		Metadata:     resp.Metadata,
+
+		FolderDestination: s.bucket,
+	}, nil
+}
+
+func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, gulter.ErrFileNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		err = s3Error(err)
+		if errors.Is(err, gulter.ErrFileNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// seekerSize returns the amount of bytes left to be read from the seeker
+func seekerSize(seeker io.ReadSeeker) (int64, error) {
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return end - current, nil
+}
+
+// s3Error converts the not found errors returned by the S3 api into
+// gulter.ErrFileNotFound
+func s3Error(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey":
+			return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/adelowo/gulter"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/ayinke-llc/hermes"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	minS3PartSize        int64 = 1024 * 1024 * 5
+	defaultS3PartSize    int64 = 1024 * 1024 * 8
+	defaultS3Concurrency       = 4
+
+	// S3 does not allow more than 10,000 parts in a single upload
+	maxS3Parts = 10000
+)
+
+// uploadMultipart splits the reader into parts and uploads them concurrently.
+// size is the total size of the reader if known, -1 otherwise
+func (s *S3Store) uploadMultipart(ctx context.Context, r io.Reader,
+	opts *gulter.UploadFileOptions, size int64,
+) (*gulter.UploadedFileMetadata, error) {
+
+	partSize := s.opts.PartSize
+
+	// make sure very large files of a known size still fit within
+	// the allowed number of parts
+	if size > 0 && size/partSize >= maxS3Parts {
+		partSize = size/maxS3Parts + 1
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(opts.FileName),
+		Metadata: opts.Metadata,
+		ACL:      s.opts.ACL,
+	}
+
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	upload, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.uploadParts(ctx, r, upload.UploadId, opts.FileName, partSize)
+	if err != nil {
+		return nil, s.abortMultipart(ctx, upload.UploadId, opts.FileName, err)
+	}
+
+	return &gulter.UploadedFileMetadata{
+		FolderDestination: s.bucket,
+		Size:              n,
+		Key:               opts.FileName,
+	}, nil
+}
+
+func (s *S3Store) uploadParts(ctx context.Context, r io.Reader,
+	uploadID *string, key string, partSize int64,
+) (int64, error) {
+
+	wg, partCtx := errgroup.WithContext(ctx)
+	wg.SetLimit(s.opts.Concurrency)
+
+	var mu sync.Mutex
+	var parts []types.CompletedPart
+	var size int64
+
+	for partNumber := int32(1); ; partNumber++ {
+		// one of the parts failed already, no need to keep reading
+		if partCtx.Err() != nil {
+			break
+		}
+
+		if partNumber > maxS3Parts {
+			_ = wg.Wait()
+			return 0, fmt.Errorf("file is too large to be uploaded in %d parts of %d bytes", maxS3Parts, partSize)
+		}
+
+		buf := make([]byte, partSize)
+
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			_ = wg.Wait()
+			return 0, readErr
+		}
+
+		// S3 requires at least one part, even if empty
+		if n == 0 && partNumber > 1 {
+			break
+		}
+
+		size += int64(n)
+
+		wg.Go(func() error {
+			resp, err := s.client.UploadPart(partCtx, &s3.UploadPartInput{
+				Bucket:        aws.String(s.bucket),
+				Key:           aws.String(key),
+				UploadId:      uploadID,
+				PartNumber:    aws.Int32(partNumber),
+				Body:          bytes.NewReader(buf[:n]),
+				ContentLength: aws.Int64(int64(n)),
+			})
+			if err != nil {
+				return fmt.Errorf("could not upload part %d: %w", partNumber, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			parts = append(parts, types.CompletedPart{
+				ETag:       resp.ETag,
+				PartNumber: aws.Int32(partNumber),
+			})
+
+			return nil
+		})
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	if err := wg.Wait(); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// abortMultipart makes sure S3 does not keep the parts of an upload that
+// failed around
+func (s *S3Store) abortMultipart(ctx context.Context, uploadID *string, key string, err error) error {
+	if s.opts.LeavePartsOnError {
+		return fmt.Errorf("multipart upload (%s) failed: %w", aws.ToString(uploadID), err)
+	}
+
+	// the original context might have been cancelled which is why the
+	// upload failed in the first place
+	_, abortErr := s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if abortErr != nil {
+		return errors.Join(err,
+			fmt.Errorf("could not abort multipart upload (%s): %w", aws.ToString(uploadID), abortErr))
+	}
+
+	return err
+}
+
+// CreateMultipartUpload starts a multipart upload. The file name goes
+// through S3Options.Layout like files uploaded with Upload
+func (s *S3Store) CreateMultipartUpload(ctx context.Context,
+	opts *gulter.UploadFileOptions,
+) (*gulter.MultipartUpload, error) {
+	key := s.opts.Layout(opts.FileName)
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Metadata,
+		ACL:      s.opts.ACL,
+	}
+
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	upload, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gulter.MultipartUpload{
+		Key:      key,
+		UploadID: aws.ToString(upload.UploadId),
+	}, nil
+}
+
+func (s *S3Store) UploadPart(ctx context.Context, upload *gulter.MultipartUpload,
+	partNumber int, r io.ReadSeeker, size int64,
+) (string, error) {
+	if partNumber < 1 || partNumber > maxS3Parts {
+		return "", fmt.Errorf("part number must be between 1 and %d", maxS3Parts)
+	}
+
+	resp, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(upload.Key),
+		UploadId:      aws.String(upload.UploadID),
+		PartNumber:    aws.Int32(int32(partNumber)),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not upload part %d: %w", partNumber, err)
+	}
+
+	return aws.ToString(resp.ETag), nil
+}
+
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, upload *gulter.MultipartUpload,
+	parts []gulter.MultipartPart,
+) (*gulter.UploadedFileMetadata, error) {
+	completed := make([]types.CompletedPart, 0, len(parts))
+
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(int32(part.Number)),
+		})
+	}
+
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.ToInt32(completed[i].PartNumber) < aws.ToInt32(completed[j].PartNumber)
+	})
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(upload.Key),
+		UploadId: aws.String(upload.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: completed,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &gulter.UploadedFileMetadata{
+		FolderDestination: s.bucket,
+		Key:               upload.Key,
+	}, nil
+}
+
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, upload *gulter.MultipartUpload) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(upload.Key),
+		UploadId: aws.String(upload.UploadID),
+	})
+
+	var notFound *types.NoSuchUpload
+	if errors.As(err, &notFound) {
+		return nil
+	}
+
+	return err
+}
+
+// MinPartSize is the smallest part S3 accepts for every part but the last
+func (s *S3Store) MinPartSize() int64 { return minS3PartSize }
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ayinke-llc/hermes"
+)
+
+// defaultPresignExpiration is how long presigned uploads are valid for if
+// PresignUploadOptions.ExpirationTime is not provided
+const defaultPresignExpiration = 15 * time.Minute
+
+// PresignUploadOptions configures an upload that goes from the client
+// straight to the bucket
+type PresignUploadOptions struct {
+	// FileName of the file. It goes through S3Options.Layout like files
+	// uploaded with Upload
+	FileName string
+
+	// KeyPrefix lets the client choose the name of the file as long as the
+	// key starts with this prefix. FileName is ignored if provided.
+	// Only supported by PresignPost
+	KeyPrefix string
+
+	// ContentType the client must upload the file with. If it ends with a
+	// slash, like image/, any content type that starts with it is allowed
+	// with PresignPost
+	ContentType string
+
+	// ContentLength is the exact size of the file. Only supported by
+	// PresignPut since a presigned PUT cannot limit the size to a range
+	ContentLength int64
+
+	// MinFileSize and MaxFileSize limit the size of the file. Either can be
+	// provided on its own. Only supported by PresignPost
+	MinFileSize int64
+	MaxFileSize int64
+
+	Metadata map[string]string
+
+	// How long the client has to start the upload. Defaults to 15 minutes
+	ExpirationTime time.Duration
+}
+
+// PresignedUpload describes the request the client has to make to upload a
+// file to the bucket
+type PresignedUpload struct {
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+
+	// Key the file will be stored under. Empty if the upload was presigned
+	// with a KeyPrefix
+	Key string `json:"key,omitempty"`
+
+	// KeyPrefix the key has to start with. The client decides the rest of
+	// the key
+	KeyPrefix string `json:"key_prefix,omitempty"`
+
+	// Headers that have to be sent with a presigned PUT
+	Headers http.Header `json:"headers,omitempty"`
+
+	// Fields that have to be sent as form values before the file with a
+	// presigned POST
+	Fields map[string]string `json:"fields,omitempty"`
+
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// UploadKey returns the key the client was allowed to upload to, so it can be
+// checked with gulter.ConfirmUpload
+func (p *PresignedUpload) UploadKey() gulter.UploadKey {
+	return gulter.UploadKey{Key: p.Key, Prefix: p.KeyPrefix}
+}
+
+func (o PresignUploadOptions) expiration() time.Duration {
+	if o.ExpirationTime <= 0 {
+		return defaultPresignExpiration
+	}
+
+	return o.ExpirationTime
+}
+
+// PresignPut returns a URL the client can PUT the file to
+func (s *S3Store) PresignPut(ctx context.Context, opts PresignUploadOptions) (*PresignedUpload, error) {
+	if hermes.IsStringEmpty(opts.FileName) {
+		return nil, errors.New("gulter: please provide a file name")
+	}
+
+	key := s.opts.Layout(opts.FileName)
+	expiration := opts.expiration()
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Metadata,
+		ACL:      s.opts.ACL,
+	}
+
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	if opts.ContentLength > 0 {
+		input.ContentLength = aws.Int64(opts.ContentLength)
+	}
+
+	req, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, input, s3.WithPresignExpires(expiration))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := req.SignedHeader.Clone()
+	headers.Del("Host")
+
+	// the content type is not part of the signature, so S3 does not enforce
+	// it. Use gulter.ConfirmUpload to check the file once it has been uploaded
+	if !hermes.IsStringEmpty(opts.ContentType) {
+		headers.Set("Content-Type", opts.ContentType)
+	}
+
+	return &PresignedUpload{
+		Method:    req.Method,
+		URL:       req.URL,
+		Key:       key,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expiration),
+	}, nil
+}
+
+// PresignPost returns a form the client can POST the file with. Unlike
+// PresignPut, the size of the file can be limited to a range and the client
+// can be allowed to pick the name of the file
+func (s *S3Store) PresignPost(ctx context.Context, opts PresignUploadOptions) (*PresignedUpload, error) {
+	if hermes.IsStringEmpty(opts.FileName) && hermes.IsStringEmpty(opts.KeyPrefix) {
+		return nil, errors.New("gulter: please provide a file name or key prefix")
+	}
+
+	clientOpts := s.client.Options()
+
+	if clientOpts.Credentials == nil {
+		return nil, errors.New("gulter: credentials are required to presign uploads")
+	}
+
+	creds, err := clientOpts.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketReq, err := s3.NewPresignClient(s.client).PresignHeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bucketURL, _, _ := strings.Cut(bucketReq.URL, "?")
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(opts.expiration())
+	date := now.Format("20060102")
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, clientOpts.Region)
+
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	if s.opts.ACL != "" {
+		fields["acl"] = string(s.opts.ACL)
+	}
+
+	for k, v := range opts.Metadata {
+		fields["x-amz-meta-"+strings.ToLower(k)] = v
+	}
+
+	conditions := []any{
+		map[string]string{"bucket": s.bucket},
+	}
+
+	var key, keyPrefix string
+
+	if !hermes.IsStringEmpty(opts.KeyPrefix) {
+		keyPrefix = opts.KeyPrefix
+		fields["key"] = opts.KeyPrefix + "${filename}"
+		conditions = append(conditions, []string{"starts-with", "$key", opts.KeyPrefix})
+	} else {
+		key = s.opts.Layout(opts.FileName)
+		fields["key"] = key
+		conditions = append(conditions, []string{"eq", "$key", key})
+	}
+
+	switch {
+	case strings.HasSuffix(opts.ContentType, "/"):
+		conditions = append(conditions, []string{"starts-with", "$Content-Type", opts.ContentType})
+	case !hermes.IsStringEmpty(opts.ContentType):
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, map[string]string{"Content-Type": opts.ContentType})
+	}
+
+	if opts.MinFileSize > 0 || opts.MaxFileSize > 0 {
+		maxFileSize := opts.MaxFileSize
+		if maxFileSize <= 0 {
+			// S3 does not accept objects larger than 5TB
+			maxFileSize = 5 << 40
+		}
+
+		conditions = append(conditions, []any{"content-length-range", opts.MinFileSize, maxFileSize})
+	}
+
+	for k, v := range fields {
+		if k == "key" || k == "Content-Type" {
+			continue
+		}
+
+		conditions = append(conditions, map[string]string{k: v})
+	}
+
+	policy, err := json.Marshal(map[string]any{
+		"expiration": expiresAt.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = hex.EncodeToString(
+		hmacSHA256(postSigningKey(creds.SecretAccessKey, date, clientOpts.Region), encodedPolicy))
+
+	return &PresignedUpload{
+		Method:    http.MethodPost,
+		URL:       bucketURL,
+		Key:       key,
+		KeyPrefix: keyPrefix,
+		Fields:    fields,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// postSigningKey derives the SigV4 key used to sign POST policies
+func postSigningKey(secret, date, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func postFile(t *testing.T, upload *PresignedUpload, fileName string, extraFields map[string]string, content []byte) int {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	for k, v := range upload.Fields {
+		require.NoError(t, writer.WriteField(k, v))
+	}
+
+	for k, v := range extraFields {
+		require.NoError(t, writer.WriteField(k, v))
+	}
+
+	part, err := writer.CreateFormFile("file", fileName)
+	require.NoError(t, err)
+
+	_, err = part.Write(content)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequest(upload.Method, upload.URL, body)
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	return resp.StatusCode
+}
+
+func TestS3Store_PresignPost(t *testing.T) {
+	tt := []struct {
+		name               string
+		opts               PresignUploadOptions
+		fileName           string
+		extraFields        map[string]string
+		content            []byte
+		expectedStatusCode int
+		expectedKey        string
+	}{
+		{
+			name: "file within the allowed size",
+			opts: PresignUploadOptions{
+				FileName:    "gulter.txt",
+				ContentType: "text/plain",
+				MaxFileSize: 1024,
+			},
+			fileName:           "gulter.txt",
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusNoContent,
+			expectedKey:        "gulter.txt",
+		},
+		{
+			name: "file larger than the allowed size",
+			opts: PresignUploadOptions{
+				FileName:    "gulter.txt",
+				MaxFileSize: 4,
+			},
+			fileName:           "gulter.txt",
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "file smaller than the allowed size",
+			opts: PresignUploadOptions{
+				FileName:    "gulter.txt",
+				MinFileSize: 1024,
+			},
+			fileName:           "gulter.txt",
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "file larger than the minimum size",
+			opts: PresignUploadOptions{
+				FileName:    "gulter.txt",
+				MinFileSize: 4,
+			},
+			fileName:           "gulter.txt",
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusNoContent,
+			expectedKey:        "gulter.txt",
+		},
+		{
+			name: "client picks the name within the prefix",
+			opts: PresignUploadOptions{
+				KeyPrefix:   "uploads/lanre/",
+				ContentType: "image/",
+			},
+			fileName:           "avatar.png",
+			extraFields:        map[string]string{"Content-Type": "image/png"},
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusNoContent,
+			expectedKey:        "uploads/lanre/avatar.png",
+		},
+		{
+			name: "content type that is not allowed",
+			opts: PresignUploadOptions{
+				KeyPrefix:   "uploads/lanre/",
+				ContentType: "image/",
+			},
+			fileName:           "avatar.png",
+			extraFields:        map[string]string{"Content-Type": "text/html"},
+			content:            []byte("hello gulter"),
+			expectedStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			fake, client := newFakeS3(t, "gulter")
+
+			store, err := NewS3FromClient(client, S3Options{
+				Bucket:       "gulter",
+				UsePathStyle: true,
+			})
+			require.NoError(t, err)
+
+			upload, err := store.PresignPost(context.Background(), v.opts)
+			require.NoError(t, err)
+			require.Equal(t, http.MethodPost, upload.Method)
+
+			if v.opts.KeyPrefix != "" {
+				require.Equal(t, gulter.UploadKey{Prefix: v.opts.KeyPrefix}, upload.UploadKey())
+			}
+
+			require.Equal(t, v.expectedStatusCode, postFile(t, upload, v.fileName, v.extraFields, v.content))
+
+			if v.expectedStatusCode != http.StatusNoContent {
+				require.Empty(t, fake.objects)
+				return
+			}
+
+			obj, ok := fake.object(v.expectedKey)
+			require.True(t, ok)
+			require.Equal(t, v.content, obj.data)
+		})
+	}
+}
+
+func TestS3Store_PresignPut(t *testing.T) {
+	fake, client := newFakeS3(t, "gulter")
+
+	store, err := NewS3FromClient(client, S3Options{
+		Bucket: "gulter",
+		Layout: HashLayout(2, 2),
+	})
+	require.NoError(t, err)
+
+	upload, err := store.PresignPut(context.Background(), PresignUploadOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+		Metadata: map[string]string{
+			gulter.MetadataOriginalName: "gulter.txt",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, upload.Method)
+	require.Equal(t, "e3/83/gulter.txt", upload.Key)
+	require.Equal(t, gulter.UploadKey{Key: "e3/83/gulter.txt"}, upload.UploadKey())
+
+	req, err := http.NewRequest(upload.Method, upload.URL, strings.NewReader("hello gulter"))
+	require.NoError(t, err)
+
+	req.Header = upload.Headers.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	obj, ok := fake.object("e3/83/gulter.txt")
+	require.True(t, ok)
+	require.Equal(t, "hello gulter", string(obj.data))
+	require.Equal(t, "text/plain", obj.contentType)
+	require.Equal(t, "gulter.txt", obj.metadata[gulter.MetadataOriginalName])
+}
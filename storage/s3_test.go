@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Store_Upload(t *testing.T) {
+	largeFile := make([]byte, minS3PartSize*2+1024)
+	_, err := rand.Read(largeFile)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name               string
+		reader             func() io.Reader
+		expected           []byte
+		expectedMultiparts int
+	}{
+		{
+			name: "small files are uploaded in one request",
+			reader: func() io.Reader {
+				// hide the seeker so we go through the unknown size path
+				return io.MultiReader(strings.NewReader("hello gulter"))
+			},
+			expected:           []byte("hello gulter"),
+			expectedMultiparts: 0,
+		},
+		{
+			name: "large seekable files are uploaded in parts",
+			reader: func() io.Reader {
+				return bytes.NewReader(largeFile)
+			},
+			expected:           largeFile,
+			expectedMultiparts: 1,
+		},
+		{
+			name: "large files of unknown size are uploaded in parts",
+			reader: func() io.Reader {
+				return io.MultiReader(bytes.NewReader(largeFile))
+			},
+			expected:           largeFile,
+			expectedMultiparts: 1,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			fake, client := newFakeS3(t, "gulter")
+
+			store, err := NewS3FromClient(client, S3Options{
+				Bucket:             "gulter",
+				PartSize:           minS3PartSize,
+				MultipartThreshold: minS3PartSize,
+				Concurrency:        2,
+			})
+			require.NoError(t, err)
+
+			metadata, err := store.Upload(context.Background(), v.reader(), &gulter.UploadFileOptions{
+				FileName:    "file.bin",
+				ContentType: "application/octet-stream",
+				Metadata: map[string]string{
+					"owner": "gulter",
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, int64(len(v.expected)), metadata.Size)
+			require.Equal(t, "file.bin", metadata.Key)
+
+			obj, ok := fake.object("file.bin")
+			require.True(t, ok)
+			require.Equal(t, v.expected, obj.data)
+			require.Equal(t, "gulter", obj.metadata["owner"])
+			require.Equal(t, "application/octet-stream", obj.contentType)
+			require.Equal(t, v.expectedMultiparts, fake.completed)
+		})
+	}
+}
+
+func TestS3Store_UploadAbortsFailedMultipartUploads(t *testing.T) {
+	largeFile := make([]byte, minS3PartSize*3)
+
+	tt := []struct {
+		name              string
+		leavePartsOnError bool
+		expectedAborted   int
+		expectedUploads   int
+	}{
+		{
+			name:            "failed uploads are aborted",
+			expectedAborted: 1,
+			expectedUploads: 0,
+		},
+		{
+			name:              "failed uploads are left as is",
+			leavePartsOnError: true,
+			expectedAborted:   0,
+			expectedUploads:   1,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			fake, client := newFakeS3(t, "gulter")
+			fake.failPart = 2
+
+			store, err := NewS3FromClient(client, S3Options{
+				Bucket:            "gulter",
+				PartSize:          minS3PartSize,
+				LeavePartsOnError: v.leavePartsOnError,
+			})
+			require.NoError(t, err)
+
+			_, err = store.Upload(context.Background(), bytes.NewReader(largeFile), &gulter.UploadFileOptions{
+				FileName: "file.bin",
+			})
+			require.Error(t, err)
+
+			_, ok := fake.object("file.bin")
+			require.False(t, ok)
+			require.Equal(t, v.expectedAborted, fake.aborted)
+			require.Len(t, fake.uploads, v.expectedUploads)
+		})
+	}
+}
+
+func TestS3Store_FileLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	_, client := newFakeS3(t, "gulter")
+
+	store, err := NewS3FromClient(client, S3Options{
+		Bucket: "gulter",
+	})
+	require.NoError(t, err)
+
+	_, err = store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+
+	exists, err := store.Exists(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	info, err := store.Stat(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(12), info.Size)
+	require.Equal(t, "text/plain", info.ContentType)
+
+	rc, _, err := store.Get(ctx, "gulter.txt")
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "hello gulter", string(b))
+
+	require.NoError(t, store.Delete(ctx, "gulter.txt"))
+
+	exists, err = store.Exists(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = store.Stat(ctx, "gulter.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	_, _, err = store.Get(ctx, "gulter.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestS3Store_ChunkedUpload(t *testing.T) {
+	largeFile := make([]byte, minS3PartSize*2+1024)
+	_, err := rand.Read(largeFile)
+	require.NoError(t, err)
+
+	fake, client := newFakeS3(t, "gulter")
+
+	store, err := NewS3FromClient(client, S3Options{
+		Bucket: "gulter",
+	})
+	require.NoError(t, err)
+
+	chunkDir := t.TempDir()
+
+	chunkStore, err := gulter.NewDiskChunkStore(chunkDir)
+	require.NoError(t, err)
+
+	g, err := gulter.New(gulter.WithStorage(store))
+	require.NoError(t, err)
+
+	handler, err := g.ChunkedUploads(gulter.ChunkedUploadOptions{
+		BasePath: "/uploads/",
+		Store:    chunkStore,
+		Field: gulter.FieldSpec{
+			Name:        "archive",
+			MaxFileSize: 1 << 30,
+			NameGenerator: func(s string) string {
+				return "archives/" + s
+			},
+		},
+		// S3 does not accept parts smaller than 5MB
+		ChunkSize: 1024,
+	})
+	require.NoError(t, err)
+
+	serve := func(method, target string, body []byte, checksum string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, bytes.NewReader(body))
+		if checksum != "" {
+			r.Header.Set(gulter.ChunkChecksumHeader, checksum)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := serve(http.MethodPost, "/uploads/",
+		[]byte(`{"file_name":"backup.bin","size":`+strconv.Itoa(len(largeFile))+`}`), "")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var status gulter.ChunkedUploadStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, minS3PartSize, status.ChunkSize)
+	require.Equal(t, 3, status.TotalChunks)
+
+	for _, index := range []int{2, 0, 1} {
+		start := int64(index) * status.ChunkSize
+		end := min(start+status.ChunkSize, int64(len(largeFile)))
+
+		chunk := largeFile[start:end]
+		sum := sha256.Sum256(chunk)
+
+		w = serve(http.MethodPut, "/uploads/"+status.ID+"/chunks/"+strconv.Itoa(index),
+			chunk, hex.EncodeToString(sum[:]))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// chunks go straight to S3, nothing but the session is kept locally
+	entries, err := os.ReadDir(chunkDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Len(t, fake.uploads, 1)
+
+	w = serve(http.MethodPost, "/uploads/"+status.ID+"/complete", nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var file gulter.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+	require.Equal(t, "archives/backup.bin", file.StorageKey)
+	require.Equal(t, "backup.bin", file.OriginalName)
+	require.Equal(t, int64(len(largeFile)), file.Size)
+
+	obj, ok := fake.object("archives/backup.bin")
+	require.True(t, ok)
+	require.Equal(t, largeFile, obj.data)
+	require.Equal(t, "backup.bin", obj.metadata[gulter.MetadataOriginalName])
+	require.Equal(t, 1, fake.completed)
+
+	// abandoned uploads are aborted so S3 removes their parts
+	w = serve(http.MethodPost, "/uploads/",
+		[]byte(`{"file_name":"backup.bin","size":`+strconv.Itoa(len(largeFile))+`}`), "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+
+	w = serve(http.MethodDelete, "/uploads/"+status.ID, nil, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, 1, fake.aborted)
+	require.Empty(t, fake.uploads)
+}
@@ -0,0 +1,683 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/ayinke-llc/hermes"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSFTPMaxConnections = 4
+	defaultSFTPDialTimeout    = 10 * time.Second
+
+	// OpenSSH extension that replaces the target of a rename atomically
+	sftpPosixRename = "posix-rename@openssh.com"
+)
+
+var errSFTPClosed = errors.New("gulter: sftp storage is closed")
+
+type SFTPOptions struct {
+	// Addr of the server as host:port. Port 22 is used if none is provided
+	Addr string
+	User string
+
+	// Password and PrivateKey can be combined, the server decides which
+	// one it accepts. PrivateKey is PEM encoded and decrypted with
+	// PrivateKeyPassphrase if provided
+	Password             string
+	PrivateKey           []byte
+	PrivateKeyPassphrase []byte
+
+	// The host key of the server is verified with HostKeyCallback, use
+	// golang.org/x/crypto/ssh/knownhosts to check a known_hosts file. If
+	// only HostKey is provided, the server must present that exact key.
+	// One of them is required
+	HostKey         ssh.PublicKey
+	HostKeyCallback ssh.HostKeyCallback
+
+	// RootDir is the folder files are stored in. Defaults to the home
+	// folder of the user
+	RootDir string
+
+	// If provided, Path returns PublicURL/key for files instead of an
+	// sftp:// URI. Useful if the server also serves the files over HTTP
+	PublicURL string
+
+	// How many connections can be open at the same time. Files returned
+	// by Get keep a connection until they are closed. Defaults to 4
+	MaxConnections int
+
+	// Defaults to 10 seconds
+	DialTimeout time.Duration
+
+	// Permissions of uploaded files. Defaults to 0644
+	FilePermissions os.FileMode
+
+	// Permissions of the folders created when a key contains a folder.
+	// Defaults to 0755
+	DirPermissions os.FileMode
+
+	// Layout decides the folders files are stored in. Folders are created
+	// as needed. Defaults to FlatLayout
+	Layout LayoutFunc
+}
+
+func (o SFTPOptions) withDefaults() SFTPOptions {
+	if _, _, err := net.SplitHostPort(o.Addr); err != nil {
+		o.Addr = net.JoinHostPort(o.Addr, "22")
+	}
+
+	if o.HostKeyCallback == nil && o.HostKey != nil {
+		o.HostKeyCallback = ssh.FixedHostKey(o.HostKey)
+	}
+
+	o.RootDir = strings.TrimSuffix(o.RootDir, "/")
+
+	o.PublicURL = strings.TrimSuffix(o.PublicURL, "/")
+
+	if o.MaxConnections <= 0 {
+		o.MaxConnections = defaultSFTPMaxConnections
+	}
+
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = defaultSFTPDialTimeout
+	}
+
+	if o.FilePermissions == 0 {
+		o.FilePermissions = 0o644
+	}
+
+	if o.DirPermissions == 0 {
+		o.DirPermissions = 0o755
+	}
+
+	if o.Layout == nil {
+		o.Layout = FlatLayout
+	}
+
+	return o
+}
+
+// SFTP stores files on a remote server over SFTP. Connections are pooled
+// and replaced once they break. A request whose connection broke is retried
+// once on a new connection, uploads only if the file had not been read yet
+type SFTP struct {
+	opts   SFTPOptions
+	config *ssh.ClientConfig
+
+	// slots limits the amount of connections in use
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*sftpConn
+	closed bool
+}
+
+// NewSFTPStorage connects to the server to verify the options and keeps the
+// connection for later use
+func NewSFTPStorage(opts SFTPOptions) (*SFTP, error) {
+	if hermes.IsStringEmpty(opts.Addr) {
+		return nil, errors.New("please provide the address of the sftp server")
+	}
+
+	if hermes.IsStringEmpty(opts.User) {
+		return nil, errors.New("please provide the sftp user")
+	}
+
+	opts = opts.withDefaults()
+
+	if opts.HostKeyCallback == nil {
+		return nil, errors.New("please provide the host key of the sftp server")
+	}
+
+	var auth []ssh.AuthMethod
+
+	if len(opts.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+
+		if len(opts.PrivateKeyPassphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(opts.PrivateKey, opts.PrivateKeyPassphrase)
+		} else {
+			signer, err = ssh.ParsePrivateKey(opts.PrivateKey)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("gulter: could not parse the sftp private key...%w", err)
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if !hermes.IsStringEmpty(opts.Password) {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("please provide a password or private key for the sftp server")
+	}
+
+	s := &SFTP{
+		opts: opts,
+		config: &ssh.ClientConfig{
+			User:            opts.User,
+			Auth:            auth,
+			HostKeyCallback: opts.HostKeyCallback,
+			Timeout:         opts.DialTimeout,
+		},
+		slots: make(chan struct{}, opts.MaxConnections),
+	}
+
+	if err := s.do(context.Background(), nil, func(*sftpConn) error { return nil }); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the idle connections. Connections held by files returned
+// from Get are closed once the files are
+func (s *SFTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	var errs []error
+	for _, conn := range s.idle {
+		errs = append(errs, conn.Close())
+	}
+
+	s.idle = nil
+
+	return errors.Join(errs...)
+}
+
+// acquire checks a connection out of the pool, connecting to the server if
+// there is no idle connection or fresh is true. It blocks while
+// MaxConnections are in use
+func (s *SFTP) acquire(ctx context.Context, fresh bool) (*sftpConn, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		<-s.slots
+		return nil, errSFTPClosed
+	}
+
+	if n := len(s.idle); n > 0 && !fresh {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+
+		return conn, nil
+	}
+
+	s.mu.Unlock()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		<-s.slots
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (s *SFTP) dial(ctx context.Context) (*sftpConn, error) {
+	dialer := net.Dialer{Timeout: s.opts.DialTimeout}
+
+	netConn, err := dialer.DialContext(ctx, "tcp", s.opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("gulter: could not connect to the sftp server...%w", err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, s.opts.Addr, s.config)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("gulter: could not connect to the sftp server...%w", err)
+	}
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, fmt.Errorf("gulter: could not start the sftp subsystem...%w", err)
+	}
+
+	return &sftpConn{ssh: sshClient, client: client}, nil
+}
+
+// release returns the connection to the pool. Broken connections are
+// closed so the next request connects again. A broken connection usually
+// means the server restarted, so the idle connections are closed as well
+func (s *SFTP) release(conn *sftpConn) {
+	s.mu.Lock()
+
+	switch {
+	case conn.broken:
+		_ = conn.Close()
+
+		for _, idle := range s.idle {
+			_ = idle.Close()
+		}
+
+		s.idle = nil
+
+	case s.closed:
+		_ = conn.Close()
+
+	default:
+		s.idle = append(s.idle, conn)
+	}
+
+	s.mu.Unlock()
+
+	<-s.slots
+}
+
+// run calls fn with a connection from the pool and returns the connection
+// if fn succeeds. If the connection turns out to be broken, fn is retried
+// once with a newly dialed connection unless retry returns false. A nil
+// retry always allows it. Cancelling the context closes the connection so
+// fn returns right away
+func (s *SFTP) run(ctx context.Context, retry func() bool, fn func(conn *sftpConn) error) (*sftpConn, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := s.acquire(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+		err = fn(conn)
+
+		if !stop() {
+			conn.broken = true
+			err = errors.Join(ctx.Err(), err)
+		}
+
+		if err == nil {
+			return conn, nil
+		}
+
+		conn.check(err)
+
+		broken := conn.broken
+		s.release(conn)
+
+		if !broken || attempt > 0 || ctx.Err() != nil || (retry != nil && !retry()) {
+			return nil, err
+		}
+	}
+}
+
+// do is run for requests that do not need the connection afterwards
+func (s *SFTP) do(ctx context.Context, retry func() bool, fn func(conn *sftpConn) error) error {
+	conn, err := s.run(ctx, retry, fn)
+	if err != nil {
+		return err
+	}
+
+	s.release(conn)
+	return nil
+}
+
+// remotePath returns the path of the key on the server. Keys cannot escape
+// RootDir
+func (s *SFTP) remotePath(key string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+
+	if s.opts.RootDir == "" {
+		return cleaned
+	}
+
+	return s.opts.RootDir + "/" + cleaned
+}
+
+// mkdirAll creates dir and its parents if they do not exist yet
+func (s *SFTP) mkdirAll(conn *sftpConn, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	info, err := conn.client.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("gulter: %s is not a directory", dir)
+		}
+
+		return nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := s.mkdirAll(conn, path.Dir(dir)); err != nil {
+		return err
+	}
+
+	if err := conn.client.Mkdir(dir); err != nil {
+		// another upload could have created it in the meantime
+		if info, statErr := conn.client.Stat(dir); statErr == nil && info.IsDir() {
+			return nil
+		}
+
+		return err
+	}
+
+	return conn.client.Chmod(dir, s.opts.DirPermissions)
+}
+
+// Upload writes the file to a temporary file in the same folder and only
+// renames it to its final name once it has been completely written, so
+// readers never see a partially written file
+func (s *SFTP) Upload(ctx context.Context, r io.Reader,
+	opts *gulter.UploadFileOptions,
+) (*gulter.UploadedFileMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key := s.opts.Layout(opts.FileName)
+	remote := s.remotePath(key)
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	tmp := path.Join(path.Dir(remote), ".gulter-"+hex.EncodeToString(suffix)+".tmp")
+
+	var size int64
+
+	// the file cannot be read again, so the upload is only retried if the
+	// connection broke before any of it was read
+	body := &sftpUploadReader{r: &contextReader{ctx: ctx, r: r}}
+
+	err := s.do(ctx, body.unread, func(conn *sftpConn) error {
+		if err := s.mkdirAll(conn, path.Dir(remote)); err != nil {
+			return err
+		}
+
+		f, err := conn.client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_EXCL)
+		if err != nil {
+			return err
+		}
+
+		err = f.Chmod(s.opts.FilePermissions)
+		if err == nil {
+			size, err = io.Copy(f, body)
+		}
+
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err == nil {
+			err = conn.rename(tmp, remote)
+		}
+
+		if err != nil {
+			if conn.check(err); !conn.broken {
+				_ = conn.client.Remove(tmp)
+			}
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &gulter.UploadedFileMetadata{
+		FolderDestination: s.opts.RootDir,
+		Size:              size,
+		Key:               key,
+	}, nil
+}
+
+// sftpUploadReader records whether the file being uploaded has been read
+type sftpUploadReader struct {
+	r    io.Reader
+	read bool
+}
+
+func (u *sftpUploadReader) Read(p []byte) (int, error) {
+	u.read = true
+	return u.r.Read(p)
+}
+
+func (u *sftpUploadReader) unread() bool { return !u.read }
+
+// Path returns PublicURL/key if provided, else an sftp:// URI that needs
+// the credentials of the server. sftp:// URIs are returned for secure paths
+// as they cannot be signed
+func (s *SFTP) Path(_ context.Context, opts gulter.PathOptions) (string, error) {
+	if !opts.IsSecure && !hermes.IsStringEmpty(s.opts.PublicURL) {
+		return s.opts.PublicURL + "/" + (&url.URL{Path: opts.Key}).EscapedPath(), nil
+	}
+
+	remote := s.remotePath(opts.Key)
+	if !strings.HasPrefix(remote, "/") {
+		// relative to the home folder of the user
+		remote = "/~/" + remote
+	}
+
+	u := &url.URL{
+		Scheme: "sftp",
+		User:   url.User(s.opts.User),
+		Host:   s.opts.Addr,
+		Path:   remote,
+	}
+
+	return u.String(), nil
+}
+
+func (s *SFTP) Get(ctx context.Context, key string) (io.ReadCloser, *gulter.FileInfo, error) {
+	var info *gulter.FileInfo
+	var file *sftp.File
+
+	conn, err := s.run(ctx, nil, func(conn *sftpConn) error {
+		var err error
+
+		info, err = s.stat(conn, key)
+		if err != nil {
+			return err
+		}
+
+		file, err = conn.client.Open(s.remotePath(key))
+		return sftpError(err)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &sftpFile{store: s, conn: conn, file: file}, info, nil
+}
+
+func (s *SFTP) Stat(ctx context.Context, key string) (*gulter.FileInfo, error) {
+	var info *gulter.FileInfo
+
+	err := s.do(ctx, nil, func(conn *sftpConn) error {
+		var err error
+		info, err = s.stat(conn, key)
+		return err
+	})
+
+	return info, err
+}
+
+// stat builds the file details. SFTP servers do not store any metadata, so
+// the content type is guessed from the extension of the file
+func (s *SFTP) stat(conn *sftpConn, key string) (*gulter.FileInfo, error) {
+	attrs, err := conn.client.Stat(s.remotePath(key))
+	if err != nil {
+		return nil, sftpError(err)
+	}
+
+	if attrs.IsDir() {
+		return nil, fmt.Errorf("%s is a directory...%w", key, gulter.ErrFileNotFound)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &gulter.FileInfo{
+		Key:          key,
+		Size:         attrs.Size(),
+		ContentType:  contentType,
+		LastModified: attrs.ModTime(),
+		ETag:         fmt.Sprintf(`W/"%x-%x"`, attrs.Size(), attrs.ModTime().Unix()),
+
+		FolderDestination: s.opts.RootDir,
+	}, nil
+}
+
+func (s *SFTP) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, gulter.ErrFileNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (s *SFTP) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, nil, func(conn *sftpConn) error {
+		err := conn.client.Remove(s.remotePath(key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func sftpError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v...%w", err, gulter.ErrFileNotFound)
+	}
+
+	return err
+}
+
+// sftpConn is a single SSH connection with an SFTP session. It is not used
+// by more than one request at a time, SFTP checks connections out of its
+// pool instead
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+
+	// broken is set once the connection failed and cannot be used anymore
+	broken bool
+}
+
+func (c *sftpConn) Close() error {
+	_ = c.client.Close()
+	return c.ssh.Close()
+}
+
+// check marks the connection as broken if err was not sent by the server
+// and the server cannot be reached anymore. Errors that do not come from
+// the server, like the ones of the file being uploaded, do not mean the
+// connection is broken
+func (c *sftpConn) check(err error) {
+	if err == nil || c.broken {
+		return
+	}
+
+	var status *sftp.StatusError
+	if errors.As(err, &status) || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+		return
+	}
+
+	if _, err := c.client.Getwd(); err != nil {
+		c.broken = true
+	}
+}
+
+// rename replaces newName with oldName. Without the posix-rename extension
+// the target has to be removed first, since a plain SFTP rename fails if
+// the target exists
+func (c *sftpConn) rename(oldName, newName string) error {
+	if _, ok := c.client.HasExtension(sftpPosixRename); ok {
+		err := c.client.PosixRename(oldName, newName)
+
+		var status *sftp.StatusError
+		if !errors.As(err, &status) || status.FxCode() != sftp.ErrSSHFxOpUnsupported {
+			return err
+		}
+	}
+
+	if err := c.client.Remove(newName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return c.client.Rename(oldName, newName)
+}
+
+// sftpFile reads a remote file. It keeps its connection out of the pool
+// until it is closed
+type sftpFile struct {
+	store  *SFTP
+	conn   *sftpConn
+	file   *sftp.File
+	closed bool
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	n, err := f.file.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		f.conn.check(err)
+	}
+
+	return n, err
+}
+
+func (f *sftpFile) Close() error {
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	err := f.file.Close()
+	f.store.release(f.conn)
+
+	return err
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewSFTPStorage(t *testing.T) {
+	fake, creds := newFakeSFTP(t, true)
+
+	otherHostKey, _ := newSFTPTestKey(t)
+	_, otherPrivateKey := newSFTPTestKey(t)
+
+	tt := []struct {
+		name     string
+		opts     SFTPOptions
+		hasError bool
+	}{
+		{
+			name:     "no host key",
+			opts:     SFTPOptions{Password: creds.password},
+			hasError: true,
+		},
+		{
+			name:     "no credentials",
+			opts:     SFTPOptions{HostKey: fake.hostKey},
+			hasError: true,
+		},
+		{
+			name:     "unknown host key",
+			opts:     SFTPOptions{Password: creds.password, HostKey: otherHostKey.PublicKey()},
+			hasError: true,
+		},
+		{
+			name:     "invalid password",
+			opts:     SFTPOptions{Password: "invalid", HostKey: fake.hostKey},
+			hasError: true,
+		},
+		{
+			name:     "invalid private key",
+			opts:     SFTPOptions{PrivateKey: otherPrivateKey, HostKey: fake.hostKey},
+			hasError: true,
+		},
+		{
+			name: "password",
+			opts: SFTPOptions{Password: creds.password, HostKey: fake.hostKey},
+		},
+		{
+			name: "private key",
+			opts: SFTPOptions{PrivateKey: creds.privateKey, HostKey: fake.hostKey},
+		},
+		{
+			name: "host key callback",
+			opts: SFTPOptions{
+				PrivateKey:      creds.privateKey,
+				HostKeyCallback: ssh.FixedHostKey(fake.hostKey),
+			},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			v.opts.Addr = fake.addr
+			v.opts.User = "gulter"
+
+			store, err := NewSFTPStorage(v.opts)
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestSFTP_AtomicUpload(t *testing.T) {
+	tt := []struct {
+		name        string
+		posixRename bool
+	}{
+		{name: "posix rename", posixRename: true},
+		{name: "remove then rename", posixRename: false},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake, creds := newFakeSFTP(t, v.posixRename)
+
+			store, err := NewSFTPStorage(SFTPOptions{
+				Addr:           fake.addr,
+				User:           "gulter",
+				Password:       creds.password,
+				HostKey:        fake.hostKey,
+				RootDir:        "/uploads",
+				DirPermissions: 0o700,
+			})
+			require.NoError(t, err)
+
+			defer store.Close()
+
+			for _, content := range []string{"first version", "second"} {
+				metadata, err := store.Upload(ctx, strings.NewReader(content), &gulter.UploadFileOptions{
+					FileName: "a/b/gulter.txt",
+				})
+				require.NoError(t, err)
+				require.Equal(t, "a/b/gulter.txt", metadata.Key)
+				require.Equal(t, int64(len(content)), metadata.Size)
+
+				b, err := os.ReadFile(filepath.Join(fake.dir, "uploads", "a", "b", "gulter.txt"))
+				require.NoError(t, err)
+				require.Equal(t, content, string(b))
+			}
+
+			info, err := os.Stat(filepath.Join(fake.dir, "uploads", "a"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+			_, err = store.Upload(ctx, io.MultiReader(strings.NewReader("partial"), iotestErrReader{io.ErrClosedPipe}),
+				&gulter.UploadFileOptions{FileName: "a/b/gulter.txt"})
+			require.ErrorIs(t, err, io.ErrClosedPipe)
+
+			// failed uploads leave neither temporary files nor a changed file behind
+			var files []string
+			require.NoError(t, filepath.WalkDir(fake.dir, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, strings.TrimPrefix(p, fake.dir))
+				}
+
+				return err
+			}))
+			require.Equal(t, []string{filepath.FromSlash("/uploads/a/b/gulter.txt")}, files)
+
+			content, _, err := store.Get(ctx, "a/b/gulter.txt")
+			require.NoError(t, err)
+
+			b, err := io.ReadAll(content)
+			require.NoError(t, err)
+			require.NoError(t, content.Close())
+			require.Equal(t, "second", string(b))
+		})
+	}
+}
+
+func TestSFTP_Reconnect(t *testing.T) {
+	tt := []struct {
+		name   string
+		pooled int
+	}{
+		{name: "single pooled connection", pooled: 1},
+		{name: "several pooled connections", pooled: 3},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake, store := newFakeSFTPStore(t, SFTPOptions{})
+			defer store.Close()
+
+			_, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+				FileName: "gulter.txt",
+			})
+			require.NoError(t, err)
+
+			// files keep their connection until they are closed, so every
+			// one of them ends up in the pool
+			var files []io.ReadCloser
+			for range v.pooled {
+				rc, _, err := store.Get(ctx, "gulter.txt")
+				require.NoError(t, err)
+
+				files = append(files, rc)
+			}
+
+			for _, rc := range files {
+				require.NoError(t, rc.Close())
+			}
+
+			logins := fake.loginCount()
+			require.Equal(t, v.pooled, logins)
+
+			// the pooled connections are broken, the upload has to be
+			// retried on a new one since none of the file was read
+			fake.dropConnections()
+
+			metadata, err := store.Upload(ctx, strings.NewReader("hello again"), &gulter.UploadFileOptions{
+				FileName: "folder/gulter.txt",
+			})
+			require.NoError(t, err)
+			require.Equal(t, int64(11), metadata.Size)
+			require.Equal(t, logins+1, fake.loginCount())
+
+			fake.dropConnections()
+
+			info, err := store.Stat(ctx, "gulter.txt")
+			require.NoError(t, err)
+			require.Equal(t, int64(12), info.Size)
+			require.Equal(t, logins+2, fake.loginCount())
+
+			require.NoError(t, store.Delete(ctx, "gulter.txt"))
+
+			exists, err := store.Exists(ctx, "gulter.txt")
+			require.NoError(t, err)
+			require.False(t, exists)
+		})
+	}
+}
+
+func TestSFTP_UploadNotRetriedOnceRead(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeSFTPStore(t, SFTPOptions{})
+	defer store.Close()
+
+	r := &dropConnectionsReader{fake: fake, r: strings.NewReader("hello gulter")}
+
+	// a retry would upload an empty file since the content is gone
+	_, err := store.Upload(ctx, r, &gulter.UploadFileOptions{FileName: "gulter.txt"})
+	require.Error(t, err)
+
+	exists, err := store.Exists(ctx, "gulter.txt")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+// dropConnectionsReader breaks the connections to the server the first time
+// it is read
+type dropConnectionsReader struct {
+	fake  *fakeSFTP
+	r     io.Reader
+	reads int
+}
+
+func (d *dropConnectionsReader) Read(p []byte) (int, error) {
+	d.reads++
+	if d.reads == 1 {
+		d.fake.dropConnections()
+	}
+
+	return d.r.Read(p)
+}
+
+func TestSFTP_Path(t *testing.T) {
+	ctx := context.Background()
+
+	fake, store := newFakeSFTPStore(t, SFTPOptions{})
+	defer store.Close()
+
+	p, err := store.Path(ctx, gulter.PathOptions{Key: "../folder/hello gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "sftp://gulter@"+fake.addr+"/~/folder/hello%20gulter.txt", p)
+
+	fake, store = newFakeSFTPStore(t, SFTPOptions{
+		RootDir:   "/var/uploads/",
+		PublicURL: "https://files.example.com/",
+	})
+	defer store.Close()
+
+	p, err = store.Path(ctx, gulter.PathOptions{Key: "folder/hello gulter.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "https://files.example.com/folder/hello%20gulter.txt", p)
+
+	p, err = store.Path(ctx, gulter.PathOptions{Key: "folder/hello gulter.txt", IsSecure: true})
+	require.NoError(t, err)
+	require.Equal(t, "sftp://gulter@"+fake.addr+"/var/uploads/folder/hello%20gulter.txt", p)
+}
@@ -0,0 +1,420 @@
+// Package storagetest verifies that gulter.Storage implementations behave the
+// same way, so code built on gulter does not depend on which backend it runs
+// against
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a new, empty instance of the storage under test. It is
+// called for every test and the storage is closed once the test is done
+type Factory func(t *testing.T) gulter.Storage
+
+type config struct {
+	metadata    bool
+	contentType bool
+}
+
+// Option configures the behaviour the conformance suite expects
+type Option func(*config)
+
+// WithoutMetadata is for backends that do not persist
+// UploadFileOptions.Metadata
+func WithoutMetadata() Option {
+	return func(c *config) {
+		c.metadata = false
+	}
+}
+
+// WithDetectedContentType is for backends that detect the content type of a
+// file instead of persisting UploadFileOptions.ContentType
+func WithDetectedContentType() Option {
+	return func(c *config) {
+		c.contentType = false
+	}
+}
+
+// RunConformance runs the tests every gulter.Storage implementation must
+// pass. Uploading a file with the name of an existing file must replace it
+// and Path must return an absolute URL, so backends have to be configured
+// accordingly
+func RunConformance(t *testing.T, factory Factory, opts ...Option) {
+	t.Helper()
+
+	cfg := &config{
+		metadata:    true,
+		contentType: true,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	tt := []struct {
+		name string
+		fn   func(t *testing.T, store gulter.Storage, cfg *config)
+	}{
+		{name: "upload and retrieve", fn: testUploadAndRetrieve},
+		{name: "metadata", fn: testMetadata},
+		{name: "size", fn: testSize},
+		{name: "overwrite", fn: testOverwrite},
+		{name: "missing files", fn: testMissingFiles},
+		{name: "delete", fn: testDelete},
+		{name: "context cancellation", fn: testContextCancellation},
+		{name: "concurrent uploads", fn: testConcurrentUploads},
+		{name: "path", fn: testPath},
+		{name: "folder destination", fn: testFolderDestination},
+		{name: "range", fn: testRange},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			store := factory(t)
+
+			t.Cleanup(func() {
+				require.NoError(t, store.Close())
+			})
+
+			v.fn(t, store, cfg)
+		})
+	}
+}
+
+func upload(t *testing.T, store gulter.Storage, name string, content []byte) *gulter.UploadedFileMetadata {
+	t.Helper()
+
+	metadata, err := store.Upload(context.Background(), bytes.NewReader(content), &gulter.UploadFileOptions{
+		FileName:    name,
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, metadata.Key)
+
+	return metadata
+}
+
+func read(t *testing.T, store gulter.Storage, key string) ([]byte, *gulter.FileInfo) {
+	t.Helper()
+
+	rc, info, err := store.Get(context.Background(), key)
+	require.NoError(t, err)
+
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+
+	return b, info
+}
+
+func testUploadAndRetrieve(t *testing.T, store gulter.Storage, _ *config) {
+	ctx := context.Background()
+
+	for _, name := range []string{"gulter.txt", "folder/hello gulter.txt"} {
+		metadata := upload(t, store, name, []byte("hello gulter"))
+
+		content, info := read(t, store, metadata.Key)
+		require.Equal(t, "hello gulter", string(content))
+		require.Equal(t, metadata.Key, info.Key)
+
+		exists, err := store.Exists(ctx, metadata.Key)
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+}
+
+func testMetadata(t *testing.T, store gulter.Storage, cfg *config) {
+	ctx := context.Background()
+
+	metadata, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName:    "gulter.txt",
+		ContentType: "text/plain",
+		Metadata: map[string]string{
+			gulter.MetadataOriginalName: url.PathEscape("my notes.txt"),
+			"owner":                     "gulter",
+		},
+	})
+	require.NoError(t, err)
+
+	stat, err := store.Stat(ctx, metadata.Key)
+	require.NoError(t, err)
+
+	_, info := read(t, store, metadata.Key)
+
+	for _, info := range []*gulter.FileInfo{stat, info} {
+		require.Equal(t, metadata.Key, info.Key)
+		require.False(t, info.LastModified.IsZero(), "last modified time must be provided")
+
+		if cfg.contentType {
+			require.Equal(t, "text/plain", info.ContentType)
+		} else {
+			require.True(t, strings.HasPrefix(info.ContentType, "text/plain"),
+				"detected content type (%s) must match the file", info.ContentType)
+		}
+
+		if cfg.metadata {
+			require.Equal(t, url.PathEscape("my notes.txt"), info.Metadata[gulter.MetadataOriginalName])
+			require.Equal(t, "gulter", info.Metadata["owner"])
+		}
+	}
+
+	require.Equal(t, stat.ETag, info.ETag)
+}
+
+func testSize(t *testing.T, store gulter.Storage, _ *config) {
+	ctx := context.Background()
+
+	large := make([]byte, 1024*1024+7)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name    string
+		content []byte
+		reader  func(b []byte) io.Reader
+	}{
+		{
+			name:    "empty.txt",
+			content: []byte{},
+			reader:  func(b []byte) io.Reader { return bytes.NewReader(b) },
+		},
+		{
+			name:    "large.bin",
+			content: large,
+			reader:  func(b []byte) io.Reader { return bytes.NewReader(b) },
+		},
+		{
+			// hide the seeker so backends cannot rely on it for the size
+			name:    "stream.bin",
+			content: large,
+			reader:  func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) },
+		},
+	}
+
+	for _, v := range tt {
+		metadata, err := store.Upload(ctx, v.reader(v.content), &gulter.UploadFileOptions{
+			FileName: v.name,
+		})
+		require.NoError(t, err, v.name)
+		require.Equal(t, int64(len(v.content)), metadata.Size, v.name)
+
+		info, err := store.Stat(ctx, metadata.Key)
+		require.NoError(t, err, v.name)
+		require.Equal(t, int64(len(v.content)), info.Size, v.name)
+
+		content, _ := read(t, store, metadata.Key)
+		require.True(t, bytes.Equal(v.content, content), "content of %s must not change", v.name)
+	}
+}
+
+func testOverwrite(t *testing.T, store gulter.Storage, _ *config) {
+	first := upload(t, store, "gulter.txt", []byte("first version"))
+	second := upload(t, store, "gulter.txt", []byte("second"))
+
+	require.Equal(t, first.Key, second.Key)
+
+	content, info := read(t, store, second.Key)
+	require.Equal(t, "second", string(content))
+	require.Equal(t, int64(6), info.Size)
+}
+
+func testMissingFiles(t *testing.T, store gulter.Storage, _ *config) {
+	ctx := context.Background()
+
+	exists, err := store.Exists(ctx, "missing.txt")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = store.Stat(ctx, "missing.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	_, _, err = store.Get(ctx, "missing.txt")
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func testDelete(t *testing.T, store gulter.Storage, _ *config) {
+	ctx := context.Background()
+
+	metadata := upload(t, store, "gulter.txt", []byte("hello gulter"))
+
+	require.NoError(t, store.Delete(ctx, metadata.Key))
+
+	exists, err := store.Exists(ctx, metadata.Key)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// deleting a file that does not exist is not an error
+	require.NoError(t, store.Delete(ctx, metadata.Key))
+}
+
+func testContextCancellation(t *testing.T, store gulter.Storage, _ *config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.Upload(ctx, strings.NewReader("hello gulter"), &gulter.UploadFileOptions{
+		FileName: "cancelled.txt",
+	})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.Canceled), "upload must fail with context.Canceled, got %v", err)
+
+	exists, err := store.Exists(context.Background(), "cancelled.txt")
+	require.NoError(t, err)
+	require.False(t, exists, "cancelled uploads must not be stored")
+
+	// a context that is cancelled while the file is being read
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &cancelReader{r: strings.NewReader("hello gulter"), cancel: cancel}
+
+	_, err = store.Upload(ctx, io.MultiReader(r, &blockingReader{ctx: ctx}), &gulter.UploadFileOptions{
+		FileName: "interrupted.txt",
+	})
+	require.Error(t, err)
+
+	exists, err = store.Exists(context.Background(), "interrupted.txt")
+	require.NoError(t, err)
+	require.False(t, exists, "interrupted uploads must not be stored")
+}
+
+func testConcurrentUploads(t *testing.T, store gulter.Storage, _ *config) {
+	var wg sync.WaitGroup
+
+	keys := make([]string, 20)
+	errs := make([]error, 20)
+
+	for i := range keys {
+		wg.Go(func() {
+			metadata, err := store.Upload(context.Background(), strings.NewReader(fmt.Sprintf("file %d", i)),
+				&gulter.UploadFileOptions{
+					FileName: fmt.Sprintf("file-%d.txt", i),
+				})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			keys[i] = metadata.Key
+		})
+	}
+
+	wg.Wait()
+
+	require.NoError(t, errors.Join(errs...))
+
+	for i, key := range keys {
+		content, _ := read(t, store, key)
+		require.Equal(t, fmt.Sprintf("file %d", i), string(content))
+	}
+}
+
+func testPath(t *testing.T, store gulter.Storage, _ *config) {
+	ctx := context.Background()
+
+	metadata := upload(t, store, "folder/hello gulter.txt", []byte("hello gulter"))
+
+	tt := []gulter.PathOptions{
+		{Key: metadata.Key},
+		{Key: metadata.Key, IsSecure: true, ExpirationTime: time.Minute},
+		// backends must fall back to a default expiration
+		{Key: metadata.Key, IsSecure: true},
+	}
+
+	for _, opts := range tt {
+		p, err := store.Path(ctx, opts)
+		require.NoError(t, err, "secure: %v", opts.IsSecure)
+
+		u, err := url.Parse(p)
+		require.NoError(t, err)
+		require.True(t, u.IsAbs(), "path (%s) must be an absolute URL", p)
+	}
+}
+
+func testFolderDestination(t *testing.T, store gulter.Storage, _ *config) {
+	metadata := upload(t, store, "folder/gulter.txt", []byte("hello gulter"))
+
+	info, err := store.Stat(context.Background(), metadata.Key)
+	require.NoError(t, err)
+	require.Equal(t, metadata.FolderDestination, info.FolderDestination)
+
+	_, info = read(t, store, metadata.Key)
+	require.Equal(t, metadata.FolderDestination, info.FolderDestination)
+}
+
+// testRange only runs against backends that implement gulter.RangeStorage
+func testRange(t *testing.T, store gulter.Storage, _ *config) {
+	rangeStore, ok := store.(gulter.RangeStorage)
+	if !ok {
+		t.Skip("storage does not implement gulter.RangeStorage")
+	}
+
+	ctx := context.Background()
+
+	metadata := upload(t, store, "gulter.txt", []byte("hello gulter"))
+	empty := upload(t, store, "empty.txt", nil)
+
+	tt := []struct {
+		key      string
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{key: metadata.Key, offset: 0, length: 5, expected: "hello"},
+		{key: metadata.Key, offset: 6, length: 6, expected: "gulter"},
+		// ranges past the end of the file are cut short
+		{key: metadata.Key, offset: 6, length: 1024, expected: "gulter"},
+		{key: empty.Key, offset: 0, length: 1024, expected: ""},
+	}
+
+	for _, v := range tt {
+		rc, err := rangeStore.GetRange(ctx, v.key, v.offset, v.length)
+		require.NoError(t, err, "%s at %d", v.key, v.offset)
+
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, v.expected, string(b))
+	}
+
+	_, err := rangeStore.GetRange(ctx, "missing.txt", 0, 5)
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+// cancelReader cancels the context once it has been read completely
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		c.cancel()
+	}
+
+	return n, err
+}
+
+// blockingReader never returns any data and fails once the context is done
+type blockingReader struct {
+	ctx context.Context
+}
+
+func (b *blockingReader) Read(_ []byte) (int, error) {
+	<-b.ctx.Done()
+	return 0, b.ctx.Err()
+}
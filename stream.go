@@ -0,0 +1,152 @@
+package gulter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// peekLen is the amount of bytes of a streamed file that is made available
+// to validators
+const peekLen = 64 * 1024
+
+// streamFiles reads the multipart form part by part and pipes every file
+// straight into the storage backend so the request is never buffered in
+// memory or to temporary files.
+// Even if an error occurs, all files that made it to the storage are returned
+func (h *Gulter) streamFiles(r *http.Request, fields []FieldSpec) (Files, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make(map[string]FieldSpec, len(fields))
+	for _, field := range fields {
+		specs[field.Name] = field
+	}
+
+	uploadedFiles := make(Files, len(fields))
+
+	values := make(url.Values)
+
+	var filesInRequest int
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return uploadedFiles, sizeLimitError(err, "", "")
+		}
+
+		key := part.FormName()
+
+		// regular form values are kept around so they can still be
+		// accessed by the next handler
+		if part.FileName() == "" {
+			var value bytes.Buffer
+
+			if _, err := io.Copy(&value, part); err != nil {
+				return uploadedFiles, sizeLimitError(err, key, "")
+			}
+
+			values.Add(key, value.String())
+			continue
+		}
+
+		filesInRequest++
+
+		if h.maxFilesPerRequest > 0 && filesInRequest > h.maxFilesPerRequest {
+			return uploadedFiles, &FileCountError{
+				Count: filesInRequest,
+				Max:   h.maxFilesPerRequest,
+			}
+		}
+
+		field, ok := specs[key]
+		if !ok {
+			continue
+		}
+
+		// we cannot know how many files there are upfront, so the limit
+		// is enforced as soon as it is exceeded
+		if field.MaxFiles > 0 && len(uploadedFiles[key]) >= field.MaxFiles {
+			return uploadedFiles, field.checkCount(len(uploadedFiles[key]) + 1)
+		}
+
+		fileData, err := h.streamFile(r, field, part)
+		if err != nil {
+			return uploadedFiles, err
+		}
+
+		uploadedFiles[key] = append(uploadedFiles[key], fileData)
+	}
+
+	for _, field := range fields {
+		files, ok := uploadedFiles[field.Name]
+		if !ok {
+			if field.Required {
+				return uploadedFiles, &MissingFieldError{FieldName: field.Name}
+			}
+
+			continue
+		}
+
+		if err := field.checkCount(len(files)); err != nil {
+			return uploadedFiles, err
+		}
+	}
+
+	// the body has been consumed at this point, we populate the form
+	// so the values can be retrieved with r.FormValue and others
+	if err := r.ParseForm(); err != nil {
+		return uploadedFiles, err
+	}
+
+	for k, v := range values {
+		r.Form[k] = append(r.Form[k], v...)
+		r.PostForm[k] = append(r.PostForm[k], v...)
+	}
+
+	r.MultipartForm = &multipart.Form{
+		Value: values,
+		File:  map[string][]*multipart.FileHeader{},
+	}
+
+	return uploadedFiles, nil
+}
+
+func (h *Gulter) streamFile(r *http.Request, field FieldSpec, part *multipart.Part) (File, error) {
+	defer part.Close()
+
+	buffered := bufio.NewReaderSize(part, peekLen)
+
+	// Peek does not consume the bytes so the entire file will still be
+	// available to the storage backend
+	peeked, err := buffered.Peek(peekLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return File{}, sizeLimitError(err, field.Name, part.FileName())
+	}
+
+	content := bytes.NewReader(peeked)
+
+	mimeType, err := h.detectMimeType(content)
+	if err != nil {
+		return File{}, fmt.Errorf("gulter: %s has invalid mimetype..%v", field.Name, err)
+	}
+
+	header := &multipart.FileHeader{
+		Filename: part.FileName(),
+		Header:   part.Header,
+		Size:     -1,
+	}
+
+	return h.uploadFile(r, field, header, mimeType, content, buffered)
+}
@@ -0,0 +1,476 @@
+package gulter
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,checksum,termination"
+
+	// tusChecksumMismatch is the status code defined by the checksum
+	// extension when a chunk does not match its checksum
+	tusChecksumMismatch = 460
+
+	defaultTusExpiration = 24 * time.Hour
+)
+
+var tusChecksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+var uploadIDPattern = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+// TusOptions configures the tus handler
+type TusOptions struct {
+	// BasePath is the path the handler is mounted at, like /files/.
+	// It is used to build the URL of every upload
+	BasePath string
+
+	// Store keeps the chunks of uploads until they are complete
+	Store StagingStore
+
+	// Field holds the rules completed files are validated with and the
+	// storage they are moved to. Its MaxFileSize is also the largest upload
+	// that can be created
+	Field FieldSpec
+
+	// Expiration is how long clients have to complete an upload.
+	// Defaults to 24 hours
+	Expiration time.Duration
+
+	// OnComplete is called once a file has been validated and uploaded to
+	// the storage backend
+	OnComplete func(r *http.Request, file File)
+}
+
+// TusUploadHandler implements the tus 1.0 resumable upload protocol
+type TusUploadHandler struct {
+	gulter *Gulter
+	opts   TusOptions
+	field  FieldSpec
+
+	// makes sure the chunks of an upload are written one after the other
+	locks uploadLocks
+}
+
+// TusHandler returns a handler that implements the tus 1.0 resumable
+// upload protocol with the creation, expiration, checksum and termination
+// extensions. Clients can resume an upload from where it stopped instead of
+// starting from scratch. Once an upload is complete, it goes through the same
+// mimetype detection and validation as the middleware and is uploaded to the
+// storage backend.
+// The file name and type are read from the filename and filetype metadata
+func (h *Gulter) TusHandler(opts TusOptions) (*TusUploadHandler, error) {
+	if opts.Store == nil {
+		return nil, errors.New("gulter: please provide a staging store")
+	}
+
+	if opts.Expiration <= 0 {
+		opts.Expiration = defaultTusExpiration
+	}
+
+	if !strings.HasSuffix(opts.BasePath, "/") {
+		opts.BasePath += "/"
+	}
+
+	return &TusUploadHandler{
+		gulter: h,
+		opts:   opts,
+		field:  h.fieldSpec(opts.Field),
+	}, nil
+}
+
+func (t *TusUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		r.Method = override
+	}
+
+	if r.Method == http.MethodOptions {
+		t.options(w)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	id, ok := strings.CutPrefix(r.URL.Path, t.opts.BasePath)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		t.create(w, r)
+		return
+	}
+
+	if !uploadIDPattern.MatchString(id) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	unlock := t.locks.lock(id)
+	defer unlock()
+
+	switch r.Method {
+	case http.MethodHead:
+		t.head(w, r, id)
+	case http.MethodPatch:
+		t.patch(w, r, id)
+	case http.MethodDelete:
+		t.terminate(w, r, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Cleanup removes the uploads that have expired along with their content.
+// Call it periodically to get rid of uploads that were abandoned by the client
+func (t *TusUploadHandler) Cleanup(ctx context.Context) error {
+	uploads, err := t.opts.Store.ExpiredUploads(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, upload := range uploads {
+		unlock := t.locks.lock(upload.ID)
+
+		if err := t.opts.Store.Delete(context.WithoutCancel(ctx), upload.ID); err != nil {
+			errs = append(errs, fmt.Errorf("gulter: could not delete expired upload (%s)...%w", upload.ID, err))
+		}
+
+		unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t *TusUploadHandler) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", "sha1,sha256,md5")
+
+	if t.field.MaxFileSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(t.field.MaxFileSize, 10))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TusUploadHandler) create(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "invalid Upload-Length header", http.StatusBadRequest)
+		return
+	}
+
+	if t.field.MaxFileSize > 0 && size > t.field.MaxFileSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	upload := &TusUpload{
+		ID:        hex.EncodeToString(b),
+		Size:      size,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(t.opts.Expiration).UTC(),
+	}
+
+	if err := t.opts.Store.Create(r.Context(), upload); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", t.opts.BasePath+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// upload retrieves an upload and writes the response if it does not exist
+// or has expired
+func (t *TusUploadHandler) upload(w http.ResponseWriter, r *http.Request, id string) (*TusUpload, bool) {
+	upload, err := t.opts.Store.Get(r.Context(), id)
+	if errors.Is(err, ErrFileNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		_ = t.opts.Store.Delete(r.Context(), id)
+
+		w.WriteHeader(http.StatusGone)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func (t *TusUploadHandler) head(w http.ResponseWriter, r *http.Request, id string) {
+	upload, ok := t.upload(w, r, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+
+	if len(upload.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (t *TusUploadHandler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	var checksum []byte
+	var hasher hash.Hash
+
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		algorithm, value, _ := strings.Cut(header, " ")
+
+		newHash, ok := tusChecksumAlgorithms[algorithm]
+		if !ok {
+			http.Error(w, "unsupported checksum algorithm", http.StatusBadRequest)
+			return
+		}
+
+		checksum, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			http.Error(w, "invalid Upload-Checksum header", http.StatusBadRequest)
+			return
+		}
+
+		hasher = newHash()
+	}
+
+	upload, ok := t.upload(w, r, id)
+	if !ok {
+		return
+	}
+
+	if offset != upload.Offset {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	ctx := r.Context()
+
+	var body io.Reader = &sizeLimitReader{r: r.Body, limit: upload.Size - offset}
+	if hasher != nil {
+		body = io.TeeReader(body, hasher)
+	}
+
+	n, err := t.opts.Store.WriteChunk(ctx, id, offset, body)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if hasher != nil {
+		// a chunk can only be verified if it was received completely
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !bytes.Equal(hasher.Sum(nil), checksum) {
+			w.WriteHeader(tusChecksumMismatch)
+			return
+		}
+	}
+
+	// whatever was received before the connection dropped is kept so the
+	// client can resume from there
+	if setErr := t.opts.Store.SetOffset(context.WithoutCancel(ctx), id, offset+n); setErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	upload.Offset = offset + n
+
+	if upload.Offset == upload.Size {
+		if err := t.complete(r, upload); err != nil {
+			t.gulter.errorResponseHandler(err).ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete validates a finished upload and moves it to the storage backend.
+// Rejected uploads are removed from the staging store
+func (t *TusUploadHandler) complete(r *http.Request, upload *TusUpload) error {
+	ctx := r.Context()
+	field := t.field
+
+	content, err := t.opts.Store.Open(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	defer content.Close()
+
+	mimeType, err := t.gulter.detectMimeType(content)
+	if err != nil {
+		return fmt.Errorf("gulter: %s has invalid mimetype..%v", field.Name, err)
+	}
+
+	originalName := upload.Metadata["filename"]
+
+	header := &multipart.FileHeader{
+		Filename: originalName,
+		Header:   textproto.MIMEHeader{},
+		Size:     upload.Size,
+	}
+
+	if fileType := upload.Metadata["filetype"]; fileType != "" {
+		header.Header.Set("Content-Type", fileType)
+	}
+
+	fileData, err := t.gulter.uploadFile(r, field, header, mimeType, content, content)
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			_ = t.opts.Store.Delete(context.WithoutCancel(ctx), upload.ID)
+		}
+
+		return err
+	}
+
+	if err := t.opts.Store.Delete(context.WithoutCancel(ctx), upload.ID); err != nil {
+		return err
+	}
+
+	if t.opts.OnComplete != nil {
+		t.opts.OnComplete(r, fileData)
+	}
+
+	return nil
+}
+
+func (t *TusUploadHandler) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := t.upload(w, r, id); !ok {
+		return
+	}
+
+	if err := t.opts.Store.Delete(r.Context(), id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTusMetadata parses the Upload-Metadata header. It is made up of comma
+// separated pairs of keys and base64 encoded values. Values are optional
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for metadata (%s)", key)
+		}
+
+		metadata[key] = string(decoded)
+	}
+
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+
+	for k, v := range metadata {
+		if v == "" {
+			pairs = append(pairs, k)
+			continue
+		}
+
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+
+	return strings.Join(pairs, ",")
+}
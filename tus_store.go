@@ -0,0 +1,212 @@
+package gulter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// TusUpload describes an upload created with the tus protocol
+type TusUpload struct {
+	ID string `json:"id"`
+
+	// Size of the entire file in bytes
+	Size int64 `json:"size"`
+
+	// Offset is how many bytes have been received so far
+	Offset int64 `json:"offset"`
+
+	// Metadata sent by the client in the Upload-Metadata header
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StagingStore keeps the chunks of uploads that have not been completed yet.
+// Once an upload is complete, it is validated and moved to the Storage
+type StagingStore interface {
+	// Create stores a new upload without any content
+	Create(ctx context.Context, upload *TusUpload) error
+
+	// Get retrieves an upload. ErrFileNotFound is returned if it does not exist
+	Get(ctx context.Context, id string) (*TusUpload, error)
+
+	// WriteChunk discards anything stored after offset, then writes r at
+	// offset and returns how many bytes were written. The offset of the
+	// upload must not be updated, it is done with SetOffset once the chunk
+	// has been verified
+	WriteChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+
+	// SetOffset records how many bytes of the upload have been received
+	SetOffset(ctx context.Context, id string, offset int64) error
+
+	// Open returns the content that has been received so far
+	Open(ctx context.Context, id string) (io.ReadSeekCloser, error)
+
+	// Delete removes the upload and its content. Deleting an upload that
+	// does not exist is not an error
+	Delete(ctx context.Context, id string) error
+
+	// ExpiredUploads lists the uploads that expired before the given time
+	ExpiredUploads(ctx context.Context, before time.Time) ([]*TusUpload, error)
+}
+
+type diskStagingStore struct {
+	root *os.Root
+}
+
+// NewDiskStagingStore returns a StagingStore that keeps uploads in a local
+// folder. Every upload is made up of a .bin file with its content and a
+// .json file with its details
+func NewDiskStagingStore(pathToFolder string) (StagingStore, error) {
+	root, err := os.OpenRoot(pathToFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskStagingStore{root: root}, nil
+}
+
+func (d *diskStagingStore) Create(_ context.Context, upload *TusUpload) error {
+	f, err := d.root.OpenFile(upload.ID+".bin", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return d.save(upload)
+}
+
+func (d *diskStagingStore) Get(_ context.Context, id string) (*TusUpload, error) {
+	b, err := d.root.ReadFile(id + ".json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%v...%w", err, ErrFileNotFound)
+		}
+
+		return nil, err
+	}
+
+	var upload TusUpload
+	if err := json.Unmarshal(b, &upload); err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func (d *diskStagingStore) WriteChunk(_ context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	f, err := d.root.OpenFile(id+".bin", os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	if err := f.Truncate(offset); err != nil {
+		return 0, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.Sync()
+}
+
+func (d *diskStagingStore) SetOffset(ctx context.Context, id string, offset int64) error {
+	upload, err := d.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	upload.Offset = offset
+
+	return d.save(upload)
+}
+
+func (d *diskStagingStore) Open(_ context.Context, id string) (io.ReadSeekCloser, error) {
+	f, err := d.root.Open(id + ".bin")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%v...%w", err, ErrFileNotFound)
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (d *diskStagingStore) Delete(_ context.Context, id string) error {
+	for _, name := range []string{id + ".bin", id + ".json"} {
+		if err := d.root.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *diskStagingStore) ExpiredUploads(ctx context.Context, before time.Time) ([]*TusUpload, error) {
+	entries, err := fs.ReadDir(d.root.FS(), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []*TusUpload
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		upload, err := d.Get(ctx, id)
+		if err != nil {
+			// the upload might have been completed in the meantime
+			if errors.Is(err, ErrFileNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if upload.ExpiresAt.Before(before) {
+			uploads = append(uploads, upload)
+		}
+	}
+
+	return uploads, nil
+}
+
+// save writes the details of an upload atomically so a crash never leaves
+// a partially written file behind
+func (d *diskStagingStore) save(upload *TusUpload) error {
+	b, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	tmp := upload.ID + ".json.tmp"
+
+	if err := d.root.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return d.root.Rename(tmp, upload.ID+".json")
+}
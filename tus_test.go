@@ -0,0 +1,401 @@
+package gulter_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adelowo/gulter"
+	"github.com/adelowo/gulter/mocks"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func tusRequest(method, target string, body []byte) *http.Request {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	r.Header.Set("Tus-Resumable", "1.0.0")
+
+	if method == http.MethodPatch {
+		r.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+
+	return r
+}
+
+func tusMetadata(name, fileType string) string {
+	return "filename " + base64.StdEncoding.EncodeToString([]byte(name)) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte(fileType))
+}
+
+func tusChecksum(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func newTusHandler(t *testing.T, storage gulter.Storage, opts gulter.TusOptions) (*gulter.TusUploadHandler, gulter.StagingStore) {
+	t.Helper()
+
+	store, err := gulter.NewDiskStagingStore(t.TempDir())
+	require.NoError(t, err)
+
+	g, err := gulter.New(gulter.WithStorage(storage))
+	require.NoError(t, err)
+
+	opts.BasePath = "/files/"
+	opts.Store = store
+
+	handler, err := g.TusHandler(opts)
+	require.NoError(t, err)
+
+	return handler, store
+}
+
+func createTusUpload(t *testing.T, handler http.Handler, size int, metadata string) string {
+	t.Helper()
+
+	r := tusRequest(http.MethodPost, "/files/", nil)
+	r.Header.Set("Upload-Length", strconv.Itoa(size))
+	r.Header.Set("Upload-Metadata", metadata)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotEmpty(t, w.Header().Get("Upload-Expires"))
+
+	return w.Header().Get("Location")
+}
+
+func TestTusHandler(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	var uploaded []byte
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, r io.Reader, opts *gulter.UploadFileOptions) (*gulter.UploadedFileMetadata, error) {
+			require.Equal(t, "image/jpeg", opts.ContentType)
+			require.Equal(t, "avatar.jpg", opts.Metadata[gulter.MetadataOriginalName])
+
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			uploaded = b
+
+			return &gulter.UploadedFileMetadata{
+				Key:  opts.FileName,
+				Size: int64(len(b)),
+			}, nil
+		}).
+		Times(1)
+
+	var completed []gulter.File
+
+	handler, store := newTusHandler(t, storage, gulter.TusOptions{
+		Field: gulter.FieldSpec{
+			Name:      "avatar",
+			Validator: gulter.MimeTypeValidator("image/jpeg"),
+		},
+		OnComplete: func(_ *http.Request, file gulter.File) {
+			completed = append(completed, file)
+		},
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/files/", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "1.0.0", w.Header().Get("Tus-Version"))
+	require.Contains(t, w.Header().Get("Tus-Extension"), "checksum")
+
+	location := createTusUpload(t, handler, len(image), tusMetadata("avatar.jpg", "image/jpeg"))
+
+	first, second := image[:len(image)/2], image[len(image)/2:]
+
+	// a chunk that does not match its checksum is discarded
+	r := tusRequest(http.MethodPatch, location, first)
+	r.Header.Set("Upload-Offset", "0")
+	r.Header.Set("Upload-Checksum", tusChecksum(second))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, 460, w.Code)
+
+	r = tusRequest(http.MethodHead, location, nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "0", w.Header().Get("Upload-Offset"))
+	require.Equal(t, strconv.Itoa(len(image)), w.Header().Get("Upload-Length"))
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	r = tusRequest(http.MethodPatch, location, first)
+	r.Header.Set("Upload-Offset", "0")
+	r.Header.Set("Upload-Checksum", tusChecksum(first))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, strconv.Itoa(len(first)), w.Header().Get("Upload-Offset"))
+
+	// the client has to resume from the offset the server has
+	r = tusRequest(http.MethodPatch, location, second)
+	r.Header.Set("Upload-Offset", "0")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	require.Empty(t, completed)
+
+	r = tusRequest(http.MethodPatch, location, second)
+	r.Header.Set("Upload-Offset", strconv.Itoa(len(first)))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, strconv.Itoa(len(image)), w.Header().Get("Upload-Offset"))
+
+	require.Equal(t, image, uploaded)
+	require.Len(t, completed, 1)
+	require.Equal(t, "avatar", completed[0].FieldName)
+	require.Equal(t, "avatar.jpg", completed[0].OriginalName)
+	require.Equal(t, "image/jpeg", completed[0].MimeType)
+	require.Equal(t, int64(len(image)), completed[0].Size)
+
+	// completed uploads are removed from the staging store
+	_, err = store.Get(context.Background(), filepath.Base(location))
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+	r = tusRequest(http.MethodHead, location, nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTusHandler_ValidationFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+
+	handler, store := newTusHandler(t, storage, gulter.TusOptions{
+		Field: gulter.FieldSpec{
+			Name:      "avatar",
+			Validator: gulter.MimeTypeValidator("image/jpeg"),
+		},
+		OnComplete: func(_ *http.Request, _ gulter.File) {
+			require.Fail(t, "rejected files must not complete")
+		},
+	})
+
+	content := []byte("<html><script>alert(1)</script></html>")
+
+	location := createTusUpload(t, handler, len(content), tusMetadata("avatar.jpg", "image/jpeg"))
+
+	r := tusRequest(http.MethodPatch, location, content)
+	r.Header.Set("Upload-Offset", "0")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	_, err := store.Get(context.Background(), filepath.Base(location))
+	require.ErrorIs(t, err, gulter.ErrFileNotFound)
+}
+
+func TestTusHandler_ConcurrentChunks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+
+	// only one of the chunks can complete the upload
+	storage.EXPECT().
+		Upload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&gulter.UploadedFileMetadata{Size: 4}, nil).
+		Times(1)
+
+	handler, _ := newTusHandler(t, storage, gulter.TusOptions{
+		Field: gulter.FieldSpec{Name: "avatar"},
+	})
+
+	location := createTusUpload(t, handler, 4, tusMetadata("notes.txt", "text/plain"))
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+
+	for range cap(codes) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			r := tusRequest(http.MethodPatch, location, []byte("gult"))
+			r.Header.Set("Upload-Offset", "0")
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	var completed int
+	for code := range codes {
+		if code == http.StatusNoContent {
+			completed++
+			continue
+		}
+
+		require.Contains(t, []int{http.StatusConflict, http.StatusNotFound}, code)
+	}
+
+	require.Equal(t, 1, completed)
+}
+
+func TestTusHandler_Requests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, store := newTusHandler(t, mocks.NewMockStorage(ctrl), gulter.TusOptions{
+		Field: gulter.FieldSpec{
+			Name:        "avatar",
+			MaxFileSize: 1024,
+		},
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		r := tusRequest(http.MethodPost, "/files/", nil)
+		r.Header.Set("Tus-Resumable", "0.2.2")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusPreconditionFailed, w.Code)
+		require.Equal(t, "1.0.0", w.Header().Get("Tus-Version"))
+	})
+
+	t.Run("upload is too large", func(t *testing.T) {
+		r := tusRequest(http.MethodPost, "/files/", nil)
+		r.Header.Set("Upload-Length", "2048")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("chunk exceeds the upload length", func(t *testing.T) {
+		location := createTusUpload(t, handler, 4, "")
+
+		r := tusRequest(http.MethodPatch, location, []byte("gulter"))
+		r.Header.Set("Upload-Offset", "0")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("invalid content type", func(t *testing.T) {
+		location := createTusUpload(t, handler, 4, "")
+
+		r := tusRequest(http.MethodPatch, location, []byte("gult"))
+		r.Header.Set("Upload-Offset", "0")
+		r.Header.Set("Content-Type", "application/octet-stream")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("terminate upload", func(t *testing.T) {
+		location := createTusUpload(t, handler, 4, "")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tusRequest(http.MethodDelete, location, nil))
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, tusRequest(http.MethodHead, location, nil))
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("method override", func(t *testing.T) {
+		location := createTusUpload(t, handler, 4, "")
+
+		r := tusRequest(http.MethodPost, location, nil)
+		r.Header.Set("X-HTTP-Method-Override", http.MethodDelete)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("expired upload", func(t *testing.T) {
+		id := "0123456789abcdef0123456789abcdef"
+
+		require.NoError(t, store.Create(context.Background(), &gulter.TusUpload{
+			ID:        id,
+			Size:      4,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tusRequest(http.MethodHead, "/files/"+id, nil))
+		require.Equal(t, http.StatusGone, w.Code)
+
+		_, err := store.Get(context.Background(), id)
+		require.ErrorIs(t, err, gulter.ErrFileNotFound)
+	})
+
+	t.Run("abandoned uploads are cleaned up", func(t *testing.T) {
+		id := "fedcba9876543210fedcba9876543210"
+
+		require.NoError(t, store.Create(context.Background(), &gulter.TusUpload{
+			ID:        id,
+			Size:      4,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		_, err := store.WriteChunk(context.Background(), id, 0, bytes.NewReader([]byte("gu")))
+		require.NoError(t, err)
+
+		location := createTusUpload(t, handler, 4, "")
+
+		require.NoError(t, handler.Cleanup(context.Background()))
+
+		_, err = store.Get(context.Background(), id)
+		require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+		_, err = store.Open(context.Background(), id)
+		require.ErrorIs(t, err, gulter.ErrFileNotFound)
+
+		_, err = store.Get(context.Background(), filepath.Base(location))
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid upload id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tusRequest(http.MethodHead, "/files/../secret", nil))
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
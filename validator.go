@@ -0,0 +1,58 @@
+package gulter
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// ValidationInput contains everything that is known about a file before it
+// is uploaded to the storage backend
+type ValidationInput struct {
+	File File
+
+	// Request is the HTTP request the file was uploaded in. It can be used
+	// to retrieve the authenticated user as an example
+	Request *http.Request
+
+	// Header is the multipart header of the file as sent by the client.
+	// When streaming uploads, Header.Size is -1 since it is not known
+	// until the file has been read completely
+	Header *multipart.FileHeader
+
+	// Content allows you read the file. When streaming uploads, only the
+	// first 64KB of the file are available.
+	// There is no need to seek back to the start of the file after reading,
+	// gulter takes care of that
+	Content io.ReadSeeker
+}
+
+// rewind seeks back to the start of the content so the next validator can
+// read it. Inputs built without content have nothing to rewind
+func (v *ValidationInput) rewind() error {
+	if v.Content == nil {
+		return nil
+	}
+
+	_, err := v.Content.Seek(0, io.SeekStart)
+	return err
+}
+
+// Validator validates a file with access to its content and the HTTP request
+// it was uploaded in
+type Validator interface {
+	Validate(ctx context.Context, input *ValidationInput) error
+}
+
+// ValidatorFunc allows a function to be used as a Validator
+type ValidatorFunc func(ctx context.Context, input *ValidationInput) error
+
+func (f ValidatorFunc) Validate(ctx context.Context, input *ValidationInput) error {
+	return f(ctx, input)
+}
+
+// Validate allows a ValidationFunc to be used anywhere a Validator is accepted
+func (f ValidationFunc) Validate(_ context.Context, input *ValidationInput) error {
+	return f(input.File)
+}
@@ -0,0 +1,260 @@
+package gulter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	// decoders for the image formats supported by ImageDimensionsValidator
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// fileSize returns the size of the file being validated. exact is false
+// when streaming uploads and the file is larger than the bytes made
+// available to validators, size is then the least the file can be
+func fileSize(input *ValidationInput) (size int64, exact bool, err error) {
+	if input.Header != nil && input.Header.Size >= 0 {
+		return input.Header.Size, true, nil
+	}
+
+	if input.Content == nil {
+		return input.File.Size, true, nil
+	}
+
+	size, err = input.Content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return size, size < peekLen, nil
+}
+
+// MaxSizeValidator rejects files larger than size bytes.
+// When streaming uploads, the size of a file larger than 64KB is only known
+// after it has been uploaded so use FieldSpec.MaxFileSize or WithMaxFileSize
+// to enforce the limit in that case
+func MaxSizeValidator(size int64) Validator {
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		n, _, err := fileSize(input)
+		if err != nil {
+			return err
+		}
+
+		if n > size {
+			return &SizeLimitError{
+				FieldName: input.File.FieldName,
+				FileName:  input.File.OriginalName,
+				Limit:     size,
+			}
+		}
+
+		return nil
+	})
+}
+
+// MinSizeValidator rejects files smaller than size bytes
+func MinSizeValidator(size int64) Validator {
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		n, exact, err := fileSize(input)
+		if err != nil {
+			return err
+		}
+
+		// the file is at least n bytes, the rest has not been read yet
+		if !exact {
+			return nil
+		}
+
+		if n < size {
+			return fmt.Errorf("gulter: file (%s) is smaller than the required %d bytes",
+				input.File.OriginalName, size)
+		}
+
+		return nil
+	})
+}
+
+// ExtensionValidator only accepts files with one of the provided extensions.
+// Extensions are matched case insensitively and the leading dot is optional
+func ExtensionValidator(extensions ...string) Validator {
+	allowed := make([]string, 0, len(extensions))
+	for _, ext := range extensions {
+		allowed = append(allowed, "."+strings.TrimPrefix(strings.ToLower(ext), "."))
+	}
+
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		ext := fileExtension(input.File.OriginalName)
+
+		if !slices.Contains(allowed, ext) {
+			return fmt.Errorf("gulter: file extension (%s) is not allowed", ext)
+		}
+
+		return nil
+	})
+}
+
+// ExtensionMatchesMimeValidator rejects files whose extension does not match
+// the mimetype detected from their content, like an executable that was
+// renamed to a .jpg file.
+// Files with an extension gulter does not know about are accepted, use
+// ExtensionValidator to restrict which extensions can be uploaded
+func ExtensionMatchesMimeValidator() Validator {
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		mimeTypes, ok := extensionMimeTypes[fileExtension(input.File.OriginalName)]
+		if !ok {
+			return nil
+		}
+
+		if !slices.Contains(mimeTypes, baseMimeType(input.File.MimeType)) {
+			return &MimeTypeError{
+				MimeType: input.File.MimeType,
+				Allowed:  mimeTypes,
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImageDimensions are the limits enforced by ImageDimensionsValidator.
+// A zero value means there is no limit
+type ImageDimensions struct {
+	MinWidth  int
+	MaxWidth  int
+	MinHeight int
+	MaxHeight int
+}
+
+// ImageDimensionsValidator only accepts JPEG, PNG and GIF images whose width
+// and height are within the provided limits. Other image formats can be
+// supported by registering their decoder with the image package
+func ImageDimensionsValidator(dimensions ImageDimensions) Validator {
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		cfg, _, err := image.DecodeConfig(input.Content)
+		if err != nil {
+			return fmt.Errorf("gulter: could not read image dimensions..%v", err)
+		}
+
+		if (dimensions.MinWidth > 0 && cfg.Width < dimensions.MinWidth) ||
+			(dimensions.MaxWidth > 0 && cfg.Width > dimensions.MaxWidth) ||
+			(dimensions.MinHeight > 0 && cfg.Height < dimensions.MinHeight) ||
+			(dimensions.MaxHeight > 0 && cfg.Height > dimensions.MaxHeight) {
+			return fmt.Errorf("gulter: image dimensions (%dx%d) are not allowed", cfg.Width, cfg.Height)
+		}
+
+		return nil
+	})
+}
+
+// reservedFilenames cannot be used as file names on Windows regardless of
+// their extension
+var reservedFilenames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// FilenameRules are the rules enforced by FilenameValidator
+type FilenameRules struct {
+	// MaxLength is the most amount of characters the file name can contain.
+	// Defaults to 255
+	MaxLength int
+
+	// AllowedCharacter reports if a character can be used in the file name.
+	// Defaults to letters, digits, spaces and ._-
+	AllowedCharacter func(r rune) bool
+
+	// ReservedNames cannot be used as file names, with or without an
+	// extension. They are matched case insensitively.
+	// Defaults to names reserved by Windows like CON and NUL
+	ReservedNames []string
+}
+
+// FilenameValidator rejects files whose original name breaks the provided
+// rules. Names that are empty, hidden or refer to a directory are always
+// rejected
+func FilenameValidator(rules FilenameRules) Validator {
+	if rules.MaxLength <= 0 {
+		rules.MaxLength = 255
+	}
+
+	if rules.AllowedCharacter == nil {
+		rules.AllowedCharacter = func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" ._-", r)
+		}
+	}
+
+	if rules.ReservedNames == nil {
+		rules.ReservedNames = reservedFilenames
+	}
+
+	return ValidatorFunc(func(_ context.Context, input *ValidationInput) error {
+		name := input.File.OriginalName
+
+		if name == "" || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("gulter: file name (%s) is not allowed", name)
+		}
+
+		if utf8.RuneCountInString(name) > rules.MaxLength {
+			return fmt.Errorf("gulter: file name is longer than the allowed %d characters", rules.MaxLength)
+		}
+
+		for _, r := range name {
+			if !rules.AllowedCharacter(r) {
+				return fmt.Errorf("gulter: file name (%s) contains an invalid character (%q)", name, r)
+			}
+		}
+
+		base, _, _ := strings.Cut(name, ".")
+		for _, reserved := range rules.ReservedNames {
+			if strings.EqualFold(strings.TrimSpace(base), reserved) {
+				return fmt.Errorf("gulter: file name (%s) is reserved", name)
+			}
+		}
+
+		return nil
+	})
+}
+
+// AnyOf returns a Validator that accepts a file if at least one of the
+// provided validators accepts it. If none does, all their errors are returned
+func AnyOf(validators ...Validator) Validator {
+	return ValidatorFunc(func(ctx context.Context, input *ValidationInput) error {
+		var errs []error
+
+		for _, validator := range validators {
+			err := validator.Validate(ctx, input)
+			if err == nil {
+				return nil
+			}
+
+			errs = append(errs, err)
+
+			if err := input.rewind(); err != nil {
+				return err
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// Not returns a Validator that only accepts a file if the provided
+// validator rejects it
+func Not(validator Validator) Validator {
+	return ValidatorFunc(func(ctx context.Context, input *ValidationInput) error {
+		if err := validator.Validate(ctx, input); err == nil {
+			return errors.New("gulter: file matches a rule it is not allowed to match")
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,220 @@
+package gulter_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adelowo/gulter"
+	"github.com/stretchr/testify/require"
+)
+
+func validationInput(t *testing.T, fileName, mimeType string, content []byte) *gulter.ValidationInput {
+	t.Helper()
+
+	return &gulter.ValidationInput{
+		File: gulter.File{
+			FieldName:    "form-field",
+			OriginalName: fileName,
+			MimeType:     mimeType,
+			Size:         int64(len(content)),
+		},
+		Header: &multipart.FileHeader{
+			Filename: fileName,
+			Size:     int64(len(content)),
+		},
+		Content: bytes.NewReader(content),
+	}
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, width, height))))
+
+	return b.Bytes()
+}
+
+func TestValidators(t *testing.T) {
+	jpeg, err := os.ReadFile(filepath.Join("testdata", "image.jpg"))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name      string
+		validator gulter.Validator
+		input     *gulter.ValidationInput
+		hasError  bool
+	}{
+		{
+			name:      "file is within the max size",
+			validator: gulter.MaxSizeValidator(10),
+			input:     validationInput(t, "notes.txt", "text/plain", []byte("gulter")),
+		},
+		{
+			name:      "file is larger than the max size",
+			validator: gulter.MaxSizeValidator(2),
+			input:     validationInput(t, "notes.txt", "text/plain", []byte("gulter")),
+			hasError:  true,
+		},
+		{
+			name:      "file is smaller than the min size",
+			validator: gulter.MinSizeValidator(10),
+			input:     validationInput(t, "notes.txt", "text/plain", []byte("gulter")),
+			hasError:  true,
+		},
+		{
+			name:      "extension is allowed regardless of case",
+			validator: gulter.ExtensionValidator("jpg", ".PNG"),
+			input:     validationInput(t, "image.JPG", "image/jpeg", jpeg),
+		},
+		{
+			name:      "extension is not allowed",
+			validator: gulter.ExtensionValidator("jpg", ".png"),
+			input:     validationInput(t, "image.gif", "image/gif", nil),
+			hasError:  true,
+		},
+		{
+			name:      "extension matches the detected mimetype",
+			validator: gulter.ExtensionMatchesMimeValidator(),
+			input:     validationInput(t, "notes.txt", "text/plain; charset=utf-8", []byte("gulter")),
+		},
+		{
+			name:      "executable renamed to a jpg",
+			validator: gulter.ExtensionMatchesMimeValidator(),
+			input:     validationInput(t, "evil.jpg", "application/octet-stream", []byte("MZ")),
+			hasError:  true,
+		},
+		{
+			name:      "unknown extensions are accepted",
+			validator: gulter.ExtensionMatchesMimeValidator(),
+			input:     validationInput(t, "data.gulter", "application/octet-stream", nil),
+		},
+		{
+			name: "image is within the dimensions",
+			validator: gulter.ImageDimensionsValidator(gulter.ImageDimensions{
+				MinWidth: 10, MaxWidth: 100, MinHeight: 10, MaxHeight: 100,
+			}),
+			input: validationInput(t, "image.png", "image/png", pngImage(t, 50, 20)),
+		},
+		{
+			name:      "image is wider than allowed",
+			validator: gulter.ImageDimensionsValidator(gulter.ImageDimensions{MaxWidth: 40}),
+			input:     validationInput(t, "image.png", "image/png", pngImage(t, 50, 20)),
+			hasError:  true,
+		},
+		{
+			name:      "file is not an image",
+			validator: gulter.ImageDimensionsValidator(gulter.ImageDimensions{MaxWidth: 40}),
+			input:     validationInput(t, "notes.txt", "text/plain", []byte("gulter")),
+			hasError:  true,
+		},
+		{
+			name:      "valid file name",
+			validator: gulter.FilenameValidator(gulter.FilenameRules{}),
+			input:     validationInput(t, "my notes-2024.txt", "text/plain", nil),
+		},
+		{
+			name:      "file name is too long",
+			validator: gulter.FilenameValidator(gulter.FilenameRules{MaxLength: 5}),
+			input:     validationInput(t, "notes.txt", "text/plain", nil),
+			hasError:  true,
+		},
+		{
+			name:      "file name contains invalid characters",
+			validator: gulter.FilenameValidator(gulter.FilenameRules{}),
+			input:     validationInput(t, "../notes.txt", "text/plain", nil),
+			hasError:  true,
+		},
+		{
+			name:      "file name is reserved",
+			validator: gulter.FilenameValidator(gulter.FilenameRules{}),
+			input:     validationInput(t, "con.txt", "text/plain", nil),
+			hasError:  true,
+		},
+		{
+			name: "all of the validators accept the file",
+			validator: gulter.AllOf(
+				gulter.MimeTypeValidator("text/plain"),
+				gulter.ExtensionValidator("txt"),
+			),
+			input: validationInput(t, "notes.txt", "text/plain", nil),
+		},
+		{
+			name: "one of all the validators rejects the file",
+			validator: gulter.AllOf(
+				gulter.ValidationFunc(func(f gulter.File) error {
+					return nil
+				}),
+				gulter.ExtensionValidator("md"),
+			),
+			input:    validationInput(t, "notes.txt", "text/plain", nil),
+			hasError: true,
+		},
+		{
+			name: "chained validation funcs accept the file",
+			validator: gulter.ChainValidators(
+				gulter.MimeTypeValidator("text/plain"),
+				func(f gulter.File) error {
+					return nil
+				},
+			),
+			input: validationInput(t, "notes.txt", "text/plain", nil),
+		},
+		{
+			name: "validators without content",
+			validator: gulter.AllOf(
+				gulter.MimeTypeValidator("text/plain"),
+				gulter.AnyOf(gulter.ExtensionValidator("md"), gulter.ExtensionValidator("txt")),
+			),
+			input: &gulter.ValidationInput{
+				File: gulter.File{OriginalName: "notes.txt", MimeType: "text/plain"},
+			},
+		},
+		{
+			name: "any of the validators accepts the file",
+			validator: gulter.AnyOf(
+				gulter.MimeTypeValidator("image/png"),
+				gulter.MimeTypeValidator("text/plain"),
+			),
+			input: validationInput(t, "notes.txt", "text/plain", nil),
+		},
+		{
+			name: "none of the validators accepts the file",
+			validator: gulter.AnyOf(
+				gulter.MimeTypeValidator("image/png"),
+				gulter.MimeTypeValidator("image/jpeg"),
+			),
+			input:    validationInput(t, "notes.txt", "text/plain", nil),
+			hasError: true,
+		},
+		{
+			name:      "not rejects a matching file",
+			validator: gulter.Not(gulter.ExtensionValidator("exe")),
+			input:     validationInput(t, "evil.exe", "application/octet-stream", nil),
+			hasError:  true,
+		},
+		{
+			name:      "not accepts a file that does not match",
+			validator: gulter.Not(gulter.ExtensionValidator("exe")),
+			input:     validationInput(t, "notes.txt", "text/plain", nil),
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := v.validator.Validate(context.Background(), v.input)
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}